@@ -35,7 +35,7 @@ func (app *application) createSongHandler(w http.ResponseWriter, r *http.Request
 	var input struct {
 		Id       string `json:"id"`
 		Title    string `json:"title"`
-		Length   int    `json:"length"`
+		Length   *int   `json:"length"`
 		Album_id int    `json:"albumId"`
 	}
 
@@ -119,7 +119,7 @@ func (app *application) updateSongHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if input.Length != nil {
-		song.Length = *input.Length
+		song.Length = input.Length
 	}
 
 	if input.Album_id != nil {
@@ -3,25 +3,28 @@ package main
 import (
 	"database/sql"
 	"flag"
-	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
+	"github.com/ulpashk/Golang_2024/pkg/jsonlog"
 	"github.com/ulpashk/Golang_2024/pkg/model"
 
 	_ "github.com/lib/pq"
 )
 
 type config struct {
-	port string
-	env  string
-	db   struct {
+	port     string
+	env      string
+	logLevel jsonlog.Level
+	db       struct {
 		dsn string
 	}
 }
 
 type application struct {
 	config config
+	logger *jsonlog.Logger
 	models model.Models
 }
 
@@ -30,19 +33,27 @@ func main() {
 	flag.StringVar(&cfg.port, "port", ":8081", "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "user=postgres password='Ulp@sh05' dbname=ourproject sslmode=disable", "PostgreSQL DSN")
+	flag.Func("log-level", "Minimum log level (info|error|fatal|off)", func(val string) error {
+		level, err := jsonlog.ParseLevel(val)
+		cfg.logLevel = level
+		return err
+	})
 	flag.Parse()
 
+	// Log JSON entries at or above the configured level to stdout
+	logger := jsonlog.New(os.Stdout, cfg.logLevel)
+
 	// Connect to DB
 	db, err := openDB(cfg)
 	if err != nil {
-		log.Fatal(err)
-		return
+		logger.PrintFatal(err, nil)
 	}
 	defer db.Close()
 
 	app := &application{
 		config: cfg,
-		models: model.NewModels(db),
+		logger: logger,
+		models: model.NewModels(db, logger),
 	}
 
 	app.run()
@@ -60,9 +71,15 @@ func (app *application) run() {
 	// Delete a specific song
 	r.HandleFunc("/songs/{songId:[0-9]+}", app.deleteSongHandler).Methods("DELETE")
 
-	log.Printf("Starting server on %s\n", app.config.port)
+	// Recover from panics in any of the handlers above
+	r.Use(app.recoverPanic)
+
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": app.config.port,
+		"env":  app.config.env,
+	})
 	err := http.ListenAndServe(app.config.port, r)
-	log.Fatal(err)
+	app.logger.PrintFatal(err, nil)
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// recoverPanic turns a panic in a handler into a 500 Internal Server Error JSON
+// response, instead of the connection being dropped, and logs the panic with the
+// details of the request.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler is used on purpose to abort a response.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				// Make the server close the connection after the response is sent.
+				w.Header().Set("Connection", "close")
+
+				app.logger.PrintError(fmt.Errorf("panic: %v", err), map[string]string{
+					"remoteAddr":    r.RemoteAddr,
+					"requestMethod": r.Method,
+					"requestUrl":    r.URL.String(),
+				})
+				app.respondWithError(w, http.StatusInternalServerError, "500 Internal Server Error")
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"goproject/internal/data"
+	"goproject/internal/validator"
+)
+
+func (app *application) createAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title       string    `json:"title"`
+		Genre       string    `json:"genre"`
+		NumOfTracks int       `json:"numOfTracks"`
+		GroupId     int       `json:"groupId"`
+		ReleaseDate data.Date `json:"releaseDate"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	album := &data.Album{
+		Title:       input.Title,
+		Genre:       input.Genre,
+		NumOfTracks: input.NumOfTracks,
+		GroupId:     input.GroupId,
+		ReleaseDate: input.ReleaseDate,
+	}
+
+	v := validator.New()
+
+	data.ValidateAlbum(v, album)
+	err = app.checkGroupReference(r.Context(), v, "groupId", album.GroupId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Albums.Insert(r.Context(), album)
+	if err != nil {
+		switch {
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/albums/%d", album.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"album": album}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v, albumFieldSafelist, albumIncludeSafelist)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	album, err := app.models.Albums.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	shaped, err := app.shapeAlbums(r.Context(), []*data.Album{album}, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"album": shaped[0]}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	album, err := app.models.Albums.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Title       string    `json:"title"`
+		Genre       string    `json:"genre"`
+		NumOfTracks int       `json:"numOfTracks"`
+		GroupId     int       `json:"groupId"`
+		ReleaseDate data.Date `json:"releaseDate"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	album.Title = input.Title
+	album.Genre = input.Genre
+	album.NumOfTracks = input.NumOfTracks
+	album.GroupId = input.GroupId
+	album.ReleaseDate = input.ReleaseDate
+
+	v := validator.New()
+
+	data.ValidateAlbum(v, album)
+	err = app.checkGroupReference(r.Context(), v, "groupId", album.GroupId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// An album can't be shrunk below the number of songs that are already on it.
+	count, err := app.models.Albums.CountSongs(r.Context(), id, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.Check(album.NumOfTracks >= count, "numOfTracks", fmt.Sprintf("must not be less than the %d songs already on the album", count))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Albums.Update(r.Context(), album)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"album": album}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Albums.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "album successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAlbumsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title   string
+		Genre   string
+		GroupId int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genre = app.readString(qs, "genre", "")
+	input.GroupId = app.readInt(qs, "group_id", 0, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "title", "genre", "numOfTracks", "releaseDate", "-id", "-title", "-genre", "-numOfTracks", "-releaseDate",
+		"group.name", "-group.name"}
+	input.Filters.Filter = app.readString(qs, "filter", "")
+	input.Filters.FilterSafelist = data.AlbumFilterSafelist
+	fs := app.readFieldset(qs, v, albumFieldSafelist, albumIncludeSafelist)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	albums, metadata, err := app.models.Albums.GetAll(r.Context(), input.Title, input.Genre, input.GroupId, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shaped, err := app.shapeAlbums(r.Context(), albums, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"albums": shaped, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listAlbumSongsHandler() handles "GET /v1/albums/:id/songs" and returns the
+// album's tracklist ordered by track number.
+func (app *application) listAlbumSongsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v, songFieldSafelist, songIncludeSafelist)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Albums.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	songs, err := app.models.Albums.GetSongs(r.Context(), id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shaped, err := app.shapeSongs(r.Context(), songs, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"songs": shaped}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkSongAlbum() helper makes sure that the album a song is being written to
+// exists, still has room for another track according to its num_of_tracks column, and
+// that the song's track number fits on it. Problems are recorded in the validator; any
+// other database error is returned to the caller.
+func (app *application) checkSongAlbum(ctx context.Context, v *validator.Validator, song *data.Song) error {
+	if song.Album_id < 1 {
+		return nil
+	}
+
+	album, err := app.models.Albums.Get(ctx, int64(song.Album_id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("albumId", "must reference an existing album")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	count, err := app.models.Albums.CountSongs(ctx, int64(album.Id), song.Id)
+	if err != nil {
+		return err
+	}
+
+	v.Check(count < album.NumOfTracks, "albumId", fmt.Sprintf("album already has all of its %d tracks", album.NumOfTracks))
+	if song.TrackNumber != nil {
+		v.Check(*song.TrackNumber <= album.NumOfTracks, "trackNumber", fmt.Sprintf("must not be greater than the album's %d tracks", album.NumOfTracks))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goproject/internal/data"
+	"goproject/internal/validator"
+)
+
+// The createApiKeyHandler() handles "POST /v1/apikeys". The plaintext key is only ever
+// included in this response (and the one from rotating the key), so the client must
+// store it straight away.
+func (app *application) createApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	key := &data.ApiKey{
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		Expiry:      input.Expiry,
+	}
+
+	v := validator.New()
+
+	if data.ValidateApiKey(v, key); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ApiKeys.Insert(r.Context(), key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.PrintInfo("api key created", map[string]string{
+		"apiKeyId":     strconv.FormatInt(key.Id, 10),
+		"apiKeyName":   key.Name,
+		"apiKeyPrefix": key.Prefix,
+		"userId":       strconv.FormatInt(app.contextGetUser(r).Id, 10),
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"apiKey": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listApiKeysHandler() handles "GET /v1/apikeys". Only the key prefixes are
+// returned, never the keys themselves.
+func (app *application) listApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.models.ApiKeys.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"apiKeys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The rotateApiKeyHandler() handles "POST /v1/apikeys/:id/rotate". It gives an active
+// key a new secret, which is returned in the response; the old one stops working.
+func (app *application) rotateApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := app.models.ApiKeys.Rotate(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.PrintInfo("api key rotated", map[string]string{
+		"apiKeyId":     strconv.FormatInt(key.Id, 10),
+		"apiKeyName":   key.Name,
+		"apiKeyPrefix": key.Prefix,
+		"userId":       strconv.FormatInt(app.contextGetUser(r).Id, 10),
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"apiKey": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revokeApiKeyHandler() handles "DELETE /v1/apikeys/:id". Revoked keys are kept
+// for the record but can no longer be used.
+func (app *application) revokeApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.ApiKeys.Revoke(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.PrintInfo("api key revoked", map[string]string{
+		"apiKeyId": strconv.FormatInt(id, 10),
+		"userId":   strconv.FormatInt(app.contextGetUser(r).Id, 10),
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
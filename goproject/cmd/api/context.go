@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"goproject/internal/data"
+)
+
+// Define a custom contextKey type, with the underlying type string.
+type contextKey string
+
+// Convert the string "user" to a contextKey type and assign it to the userContextKey
+// constant. We'll use this constant as the key for getting and setting user information
+// in the request context.
+const userContextKey = contextKey("user")
+
+// The apiKeyContextKey is used for the API key a request was authenticated with, if
+// any.
+const apiKeyContextKey = contextKey("apiKey")
+
+// The contextSetUser() method returns a new copy of the request with the provided
+// User struct added to the context. Note that we use our userContextKey constant as the
+// key.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// The contextGetUser() retrieves the User struct from the request context. The only
+// time that we'll use this helper is when we logically expect there to be User struct
+// value in the context, and if it doesn't exist it will firmly be an 'unexpected' error.
+// As we discussed earlier in the book, it's OK to panic in those circumstances.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// The contextSetApiKey() method returns a new copy of the request with the API key the
+// client authenticated with added to the context, along with the user it acts as.
+func (app *application) contextSetApiKey(r *http.Request, key *data.ApiKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return app.contextSetUser(r.WithContext(ctx), key.User())
+}
+
+// The contextGetApiKey() method retrieves the API key from the request context. Unlike
+// contextGetUser() it returns nil, rather than panicking, when there is none, as most
+// requests are not made with an API key.
+func (app *application) contextGetApiKey(r *http.Request) *data.ApiKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.ApiKey)
+	return key
+}
+
+// The contextSetRequestID() method returns a new copy of the request with its request
+// ID added to the context. The ID is stored by the data package, so that the database
+// queries run for the request are tagged with it too.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(data.ContextWithRequestID(r.Context(), id))
+}
+
+// The contextGetRequestID() method retrieves the request ID from the request context.
+// It returns "" for requests that haven't been through the requestID() middleware.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	return data.RequestIDFromContext(r.Context())
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"goproject/internal/data"
 )
 
+// statusClientClosedRequest is the non-standard status code nginx uses for requests
+// that the client gave up on before the response was sent.
+const statusClientClosedRequest = 499
+
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
@@ -15,19 +25,23 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
-// The logError() method is a generic helper for logging an error message. Later in the
-// book we'll upgrade this to use structured logging, and record additional information
-// about the request including the HTTP method and URL.
+// The logError() method is a generic helper for logging an error message along with
+// the current request method, URL and ID as properties in the log entry.
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.Println(err)
+	app.logger.PrintError(err, map[string]string{
+		"requestMethod": r.Method,
+		"requestUrl":    r.URL.String(),
+		"requestId":     app.contextGetRequestID(r),
+	})
 }
 
 // The errorResponse() method is a generic helper for sending JSON-formatted error
 // messages to the client with a given status code. Note that we're using an interface{}
 // type for the message parameter, rather than just a string type, as this gives us
-// more flexibility over the values that we can include in the response.
+// more flexibility over the values that we can include in the response. The request ID
+// is included as well, so that clients can quote it when reporting a problem.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	env := envelope{"error": message}
+	env := envelope{"error": message, "requestId": app.contextGetRequestID(r)}
 
 	// Write the response using the writeJSON() helper. If this happens to return an
 	// error then log it, and fall back to sending the client an empty response with a
@@ -42,13 +56,35 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 // The serverErrorResponse() method will be used when our application encounters an
 // unexpected problem at runtime. It logs the detailed error message, then uses the
 // errorResponse() helper to send a 500 Internal Server Error status code and JSON
-// response (containing a generic error message) to the client.
+// response (containing a generic error message) to the client. If the client has gone
+// away, the error is most likely just a consequence of the canceled request context
+// (such as a query being aborted), so requestCanceledResponse() is used instead.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(r.Context().Err(), context.Canceled) {
+		app.requestCanceledResponse(w, r, err)
+		return
+	}
+
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// The requestCanceledResponse() method is used when the client cancels a request, for
+// example by closing the connection, before we're done with it. This isn't a problem
+// on our side, so it's logged at the INFO level rather than as an error, and the
+// response (which the client will most likely never see) has a 499 status code.
+func (app *application) requestCanceledResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.PrintInfo("request canceled", map[string]string{
+		"error":         err.Error(),
+		"requestMethod": r.Method,
+		"requestUrl":    r.URL.String(),
+		"requestId":     app.contextGetRequestID(r),
+	})
+	message := "the request was canceled"
+	app.errorResponse(w, r, statusClientClosedRequest, message)
+}
+
 // The notFoundResponse() method will be used to send a 404 Not Found status code and
 // JSON response to the client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -62,3 +98,116 @@ func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
+
+// The constraintViolationResponse() method is used when a write is rejected by one of
+// the database constraints. Duplicates are reported with a 409 Conflict and everything
+// else with a 422 Unprocessable Entity. In both cases the response carries a
+// field-level errors map, the same shape failedValidationResponse() uses.
+func (app *application) constraintViolationResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var constraintErr *data.ConstraintError
+	if !errors.As(err, &constraintErr) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusUnprocessableEntity
+	var message string
+
+	switch {
+	case errors.Is(err, data.ErrDuplicateID):
+		status = http.StatusConflict
+		message = "a record with this id already exists"
+	case errors.Is(err, data.ErrDuplicateValue):
+		status = http.StatusConflict
+		message = "must be unique"
+	case errors.Is(err, data.ErrInvalidReference):
+		message = "must reference an existing record"
+	case errors.Is(err, data.ErrMissingValue):
+		message = "must be provided"
+	default:
+		message = "is not a valid value"
+	}
+
+	app.errorResponse(w, r, status, map[string]string{constraintErr.Field: message})
+}
+
+// The recordInUseResponse() method will be used to send a 409 Conflict status code when
+// a record can't be deleted because other records still reference it.
+func (app *application) recordInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to delete the resource because other resources still reference it"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The editConflictResponse() method will be used to send a 409 Conflict status code
+// when an update is rejected because the record was changed by someone else since the
+// client last read it.
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The unsupportedMediaTypeResponse() method will be used to send a 415 Unsupported Media
+// Type status code when the request body is in a format the endpoint doesn't accept. The
+// accepted formats are advertised in an Accept-Patch header.
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, accepted ...string) {
+	w.Header().Set("Accept-Patch", strings.Join(accepted, ", "))
+	message := fmt.Sprintf("the request body must have one of the content types: %s", strings.Join(accepted, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// The invalidCredentialsResponse() method will be used to send a 401 Unauthorized
+// status code when the email address or password sent to create a token is wrong.
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The invalidAuthenticationTokenResponse() method will be used to send a 401
+// Unauthorized status code when the bearer token in the Authorization header is
+// malformed, unknown or expired. The WWW-Authenticate header tells the client what went
+// wrong, following RFC 6750.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The authenticationRequiredResponse() method will be used to send a 401 Unauthorized
+// status code when an anonymous client calls an endpoint that needs a user.
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The inactiveAccountResponse() method will be used to send a 403 Forbidden status code
+// when the user is authenticated but hasn't activated their account yet.
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The notPermittedResponse() method will be used to send a 403 Forbidden status code
+// when the user is activated but doesn't have the permission an endpoint requires.
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The invalidApiKeyResponse() method will be used to send a 401 Unauthorized status
+// code when the key in the X-API-Key header is malformed, unknown, expired or revoked.
+func (app *application) invalidApiKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	message := "invalid, expired or revoked API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The rateLimitExceededResponse() method will be used to send a 429 Too Many Requests
+// status code when a client has used up its quota. The Retry-After header says how
+// many seconds the client should wait before trying again.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"goproject/internal/data"
+	"goproject/internal/validator"
+)
+
+// The fields each resource can be trimmed to with the fields parameter, and the related
+// resources that can be embedded in it with the include parameter. Nested relations
+// are written with a dot, so "album.group" embeds the group in the song's album.
+var (
+	songFieldSafelist     = []string{"id", "title", "length", "albumId", "trackNumber", "version"}
+	songIncludeSafelist   = []string{"album", "album.group"}
+	albumFieldSafelist    = []string{"id", "title", "genre", "numOfTracks", "groupId", "releaseDate"}
+	albumIncludeSafelist  = []string{"group"}
+	groupFieldSafelist    = []string{"id", "name", "numOfMembers", "launchDate"}
+	groupIncludeSafelist  = []string{}
+	singerFieldSafelist   = []string{"id", "firstName", "lastName", "birthday", "groupId"}
+	singerIncludeSafelist = []string{"group"}
+)
+
+// fieldset holds the fields and include query string parameters of a request.
+type fieldset struct {
+	fields  []string
+	include []string
+}
+
+// The readFieldset() helper reads the fields and include parameters from the query
+// string, and checks every value against the given safelists, recording an error in
+// the validator for any it doesn't know about.
+func (app *application) readFieldset(qs url.Values, v *validator.Validator, fieldSafelist, includeSafelist []string) fieldset {
+	fs := fieldset{
+		fields:  app.readCSV(qs, "fields", []string{}),
+		include: app.readCSV(qs, "include", []string{}),
+	}
+
+	for _, field := range fs.fields {
+		v.Check(validator.In(field, fieldSafelist...), "fields", fmt.Sprintf("unknown field %q", field))
+	}
+	for _, include := range fs.include {
+		v.Check(validator.In(include, includeSafelist...), "include", fmt.Sprintf("unknown relation %q", include))
+	}
+
+	return fs
+}
+
+// Report whether the response is sent unchanged.
+func (fs fieldset) empty() bool {
+	return len(fs.fields) == 0 && len(fs.include) == 0
+}
+
+// Report whether the named relation should be embedded. Including a nested relation
+// such as "album.group" implies its parent.
+func (fs fieldset) includes(name string) bool {
+	for _, include := range fs.include {
+		if include == name || strings.HasPrefix(include, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove the members of a document that were not asked for. Embedded relations are
+// always kept, so that include works together with fields.
+func (fs fieldset) trim(doc map[string]interface{}) {
+	if len(fs.fields) == 0 {
+		return
+	}
+	for key := range doc {
+		if !validator.In(key, fs.fields...) && !fs.includes(key) {
+			delete(doc, key)
+		}
+	}
+}
+
+// The toDocument() helper converts a value to its JSON object form, so that members
+// can be removed from it and related resources added. Numbers are kept as json.Number
+// so that they are encoded again unchanged.
+func toDocument(value interface{}) (map[string]interface{}, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	err = dec.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// The shapeSongs() helper applies a fieldset to a slice of songs, returning the values
+// to send in the response. When the client asked for neither fields nor include, these
+// are the songs themselves. Related albums (and their groups) are fetched with one
+// query per relation, however many songs there are.
+func (app *application) shapeSongs(ctx context.Context, songs []*data.Song, fs fieldset) ([]interface{}, error) {
+	shaped := make([]interface{}, len(songs))
+	if fs.empty() {
+		for i, song := range songs {
+			shaped[i] = song
+		}
+		return shaped, nil
+	}
+
+	docs := make([]map[string]interface{}, len(songs))
+	for i, song := range songs {
+		doc, err := toDocument(song)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+
+	if fs.includes("album") {
+		ids := make([]int64, len(songs))
+		for i, song := range songs {
+			ids[i] = int64(song.Album_id)
+		}
+		albums, err := app.albumDocuments(ctx, ids, fs.includes("album.group"))
+		if err != nil {
+			return nil, err
+		}
+		for i, song := range songs {
+			docs[i]["album"] = albums[song.Album_id]
+		}
+	}
+
+	for i, doc := range docs {
+		fs.trim(doc)
+		shaped[i] = doc
+	}
+	return shaped, nil
+}
+
+// The shapeAlbums() helper applies a fieldset to a slice of albums.
+func (app *application) shapeAlbums(ctx context.Context, albums []*data.Album, fs fieldset) ([]interface{}, error) {
+	shaped := make([]interface{}, len(albums))
+	if fs.empty() {
+		for i, album := range albums {
+			shaped[i] = album
+		}
+		return shaped, nil
+	}
+
+	docs := make([]map[string]interface{}, len(albums))
+	for i, album := range albums {
+		doc, err := toDocument(album)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+
+	if fs.includes("group") {
+		ids := make([]int64, len(albums))
+		for i, album := range albums {
+			ids[i] = int64(album.GroupId)
+		}
+		groups, err := app.groupDocuments(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, album := range albums {
+			docs[i]["group"] = groups[album.GroupId]
+		}
+	}
+
+	for i, doc := range docs {
+		fs.trim(doc)
+		shaped[i] = doc
+	}
+	return shaped, nil
+}
+
+// The shapeGroups() helper applies a fieldset to a slice of groups. Groups have no
+// relations that can be embedded, so only fields applies.
+func (app *application) shapeGroups(ctx context.Context, groups []*data.Group, fs fieldset) ([]interface{}, error) {
+	shaped := make([]interface{}, len(groups))
+	if fs.empty() {
+		for i, group := range groups {
+			shaped[i] = group
+		}
+		return shaped, nil
+	}
+
+	for i, group := range groups {
+		doc, err := toDocument(group)
+		if err != nil {
+			return nil, err
+		}
+		fs.trim(doc)
+		shaped[i] = doc
+	}
+	return shaped, nil
+}
+
+// The shapeSingers() helper applies a fieldset to a slice of singers. Singers who are
+// not in a group get a null group when it is included.
+func (app *application) shapeSingers(ctx context.Context, singers []*data.Singer, fs fieldset) ([]interface{}, error) {
+	shaped := make([]interface{}, len(singers))
+	if fs.empty() {
+		for i, singer := range singers {
+			shaped[i] = singer
+		}
+		return shaped, nil
+	}
+
+	docs := make([]map[string]interface{}, len(singers))
+	for i, singer := range singers {
+		doc, err := toDocument(singer)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+
+	if fs.includes("group") {
+		var ids []int64
+		for _, singer := range singers {
+			if singer.GroupId != nil {
+				ids = append(ids, int64(*singer.GroupId))
+			}
+		}
+		groups, err := app.groupDocuments(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, singer := range singers {
+			docs[i]["group"] = nil
+			if singer.GroupId != nil {
+				docs[i]["group"] = groups[*singer.GroupId]
+			}
+		}
+	}
+
+	for i, doc := range docs {
+		fs.trim(doc)
+		shaped[i] = doc
+	}
+	return shaped, nil
+}
+
+// The albumDocuments() helper fetches the albums with the given IDs in one query and
+// returns them in their document form, keyed by ID. If withGroup is true, each album
+// has its group embedded as well.
+func (app *application) albumDocuments(ctx context.Context, ids []int64, withGroup bool) (map[int]map[string]interface{}, error) {
+	albums, err := app.models.Albums.GetMany(ctx, uniqueIDs(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	var groups map[int]map[string]interface{}
+	if withGroup {
+		groupIds := make([]int64, 0, len(albums))
+		for _, album := range albums {
+			groupIds = append(groupIds, int64(album.GroupId))
+		}
+		groups, err = app.groupDocuments(ctx, groupIds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	docs := make(map[int]map[string]interface{}, len(albums))
+	for id, album := range albums {
+		doc, err := toDocument(album)
+		if err != nil {
+			return nil, err
+		}
+		if withGroup {
+			doc["group"] = groups[album.GroupId]
+		}
+		docs[id] = doc
+	}
+	return docs, nil
+}
+
+// The groupDocuments() helper fetches the groups with the given IDs in one query and
+// returns them in their document form, keyed by ID.
+func (app *application) groupDocuments(ctx context.Context, ids []int64) (map[int]map[string]interface{}, error) {
+	groups, err := app.models.Groups.GetMany(ctx, uniqueIDs(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[int]map[string]interface{}, len(groups))
+	for id, group := range groups {
+		doc, err := toDocument(group)
+		if err != nil {
+			return nil, err
+		}
+		docs[id] = doc
+	}
+	return docs, nil
+}
+
+// Remove duplicates from a slice of IDs, keeping the first occurrence of each.
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := []int64{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
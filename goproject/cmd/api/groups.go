@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"goproject/internal/data"
+	"goproject/internal/validator"
+)
+
+func (app *application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string    `json:"name"`
+		NumOfMembers int       `json:"numOfMembers"`
+		LaunchDate   data.Date `json:"launchDate"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{
+		Name:         input.Name,
+		NumOfMembers: input.NumOfMembers,
+		LaunchDate:   input.LaunchDate,
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.Insert(r.Context(), group)
+	if err != nil {
+		switch {
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/groups/%d", group.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v, groupFieldSafelist, groupIncludeSafelist)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	group, err := app.models.Groups.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	shaped, err := app.shapeGroups(r.Context(), []*data.Group{group}, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": shaped[0]}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	group, err := app.models.Groups.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name         string    `json:"name"`
+		NumOfMembers int       `json:"numOfMembers"`
+		LaunchDate   data.Date `json:"launchDate"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	group.Name = input.Name
+	group.NumOfMembers = input.NumOfMembers
+	group.LaunchDate = input.LaunchDate
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.Update(r.Context(), group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Groups.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "group successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "numOfMembers", "launchDate", "-id", "-name", "-numOfMembers", "-launchDate"}
+	input.Filters.Filter = app.readString(qs, "filter", "")
+	input.Filters.FilterSafelist = data.GroupFilterSafelist
+	fs := app.readFieldset(qs, v, groupFieldSafelist, groupIncludeSafelist)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	groups, metadata, err := app.models.Groups.GetAll(r.Context(), input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shaped, err := app.shapeGroups(r.Context(), groups, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"groups": shaped, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showGroupDiscographyHandler() handles "GET /v1/groups/:id/discography" and
+// returns the group, its albums in release order and the songs on each album in a
+// single response. The discography is always sent whole, so the fields and include
+// parameters are rejected rather than silently ignored.
+func (app *application) showGroupDiscographyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	v.Check(!qs.Has("fields"), "fields", "is not supported on this endpoint")
+	v.Check(!qs.Has("include"), "include", "is not supported on this endpoint")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	discography, err := app.models.Groups.GetDiscography(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"discography": discography}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkGroupReference() helper records a validation error against key if no group
+// with the given ID exists. Any other database error is returned to the caller. IDs
+// below 1 are left to the Validate*() functions to report.
+func (app *application) checkGroupReference(ctx context.Context, v *validator.Validator, key string, id int) error {
+	if id < 1 {
+		return nil
+	}
+
+	_, err := app.models.Groups.Get(ctx, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError(key, "must reference an existing group")
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goproject/internal/jsonlog"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestNestedRoutesValidateFieldset(t *testing.T) {
+	// The parameters are checked before the database is touched, so the application
+	// doesn't need any models.
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelOff)}
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/v1/groups/:id/members", app.listGroupMembersHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/groups/:id/discography", app.showGroupDiscographyHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/albums/:id/songs", app.listAlbumSongsHandler)
+
+	urls := []string{
+		"/v1/groups/1/members?fields=title",
+		"/v1/groups/1/members?include=album",
+		"/v1/groups/1/discography?fields=id",
+		"/v1/groups/1/discography?include=group",
+		"/v1/albums/1/songs?fields=genre",
+		"/v1/albums/1/songs?include=group",
+	}
+
+	for _, url := range urls {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status %d; want %d", url, rr.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
@@ -148,18 +148,18 @@ func (app *application) readString(qs url.Values, key string, defaultValue strin
 // into a slice on the comma character. If no matching key could be found, it returns
 // the provided default value.
 
-// func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
-// 	// Extract the value from the query string.
-// 	csv := qs.Get(key)
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	// Extract the value from the query string.
+	csv := qs.Get(key)
 	
-// 	// If no key exists (or the value is empty) then return the default value.
-// 	if csv == "" {
-// 		return defaultValue
-// 	}
+	// If no key exists (or the value is empty) then return the default value.
+	if csv == "" {
+		return defaultValue
+	}
 
-// 	// Otherwise parse the value into a []string slice and return it.
-// 	return strings.Split(csv, ",")
-// }
+	// Otherwise parse the value into a []string slice and return it.
+	return strings.Split(csv, ",")
+}
 
 // The readInt() helper reads a string value from the query string and converts it to an
 // integer before returning. If no matching key could be found it returns the provided
@@ -183,4 +183,65 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	// Otherwise, return the converted integer value.
 	return i
-}
\ No newline at end of file
+}
+
+// The readBool() helper reads a boolean value from the query string. If no matching key
+// could be found it returns nil, so that callers can tell "not provided" apart from an
+// explicit false. If the value couldn't be parsed, then we record an error message in
+// the provided Validator instance.
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+	return &b
+}
+
+// The readIfMatchVersion() helper reads the record version a client expects from the
+// If-Match request header. Both the plain form (If-Match: 3) and the quoted ETag form
+// (If-Match: "3") are accepted. The boolean return value is false if the header is
+// missing or set to "*", in which case no version check should be made.
+func (app *application) readIfMatchVersion(r *http.Request) (int32, bool, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, false, nil
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	value = strings.Trim(value, `"`)
+
+	version, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || version < 1 {
+		return 0, false, errors.New("invalid If-Match header, expected the record version")
+	}
+	return int32(version), true, nil
+}
+
+// The background() helper accepts an arbitrary function as a parameter and runs it in
+// a background goroutine. Any panic in the function is recovered and logged, rather
+// than terminating the application. The goroutine is tracked in app.wg, so that a
+// graceful shutdown waits for it to finish.
+func (app *application) background(fn func()) {
+	// Increment the WaitGroup counter.
+	app.wg.Add(1)
+
+	go func() {
+		// Use defer to decrement the WaitGroup counter before the goroutine returns.
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
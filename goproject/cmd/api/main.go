@@ -3,13 +3,18 @@ package main
 import (
 	"context" 
 	"database/sql" 
+	"errors"
 	"flag"
-	"fmt"
-	"log"
-	"net/http"
+	"math"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"goproject/internal/data"
+	"goproject/internal/jsonlog"
+	"goproject/internal/mailer"
 
 
 	// Import the pq driver so that it can register itself with the database/sql
@@ -26,8 +31,42 @@ const version = "1.0.0"
 type config struct {
 	port int
 	env string
+	// How long to wait for in-flight requests and background tasks to finish when the
+	// server is shutting down.
+	shutdownTimeout time.Duration
+	// Log entries below this severity level are not written.
+	logLevel jsonlog.Level
 	db struct {
 		dsn string
+		// The deadlines for reads of single records, for listings, and for writes.
+		timeouts data.Timeouts
+	}
+	// Add a new limiter struct containing fields for the requests-per-second and burst
+	// values, and a boolean field which we can use to enable/disable rate limiting
+	// altogether. Clients are told apart by IP address, or by the value of
+	// trustedHeader when the request comes from one of the trustedNetworks (such as a
+	// gateway that sets the header).
+	limiter struct {
+		rps             float64
+		burst           int
+		enabled         bool
+		trustedHeader   string
+		trustedNetworks []*net.IPNet
+	}
+	// Metrics are served on /debug/metrics. If addr is set they get a listener of their
+	// own, otherwise they are served by the API server, but only to clients in one of
+	// the allowedNetworks.
+	metrics struct {
+		addr            string
+		allowedNetworks []*net.IPNet
+	}
+	// The SMTP server used to send emails, such as the activation token for new users.
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
 	}
 }
 
@@ -35,9 +74,12 @@ type config struct {
 // and middleware. At the moment this only contains a copy of the config struct and a
 // logger, but it will grow to include a lot more as our build progresses.
 type application struct {
-	config config
-	logger *log.Logger
-	models data.Models
+	config  config
+	logger  *jsonlog.Logger
+	models  data.Models
+	metrics *appMetrics
+	mailer  mailer.Mailer
+	wg      sync.WaitGroup
 }
 
 func main() {
@@ -48,16 +90,82 @@ func main() {
 	// corresponding flags are provided.
 	flag.IntVar(&cfg.port, "port", 8080, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 20*time.Second, "Graceful shutdown deadline")
+	flag.Func("log-level", "Minimum log level (info|error|fatal|off)", func(val string) error {
+		level, err := jsonlog.ParseLevel(val)
+		cfg.logLevel = level
+		return err
+	})
 	
 	// Read the DSN value from the db-dsn command-line flag into the config struct. We
 	// default to using our development DSN if no flag is provided.
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "user=postgres password='Ulp@sh05' dbname=goproject sslmode=disable", "PostgreSQL DSN")
+	flag.DurationVar(&cfg.db.timeouts.Read, "db-read-timeout", 3*time.Second, "PostgreSQL timeout for reading a single record")
+	flag.DurationVar(&cfg.db.timeouts.List, "db-list-timeout", 3*time.Second, "PostgreSQL timeout for listings and reports")
+	flag.DurationVar(&cfg.db.timeouts.Write, "db-write-timeout", 3*time.Second, "PostgreSQL timeout for writes")
+
+	// Read the SMTP server configuration settings into the config struct. By default
+	// mail goes to a relay on the local machine.
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Goproject <no-reply@goproject.local>", "SMTP sender")
+
+	// Create command line flags to read the setting values into the config struct.
+	// Notice that we use true as the default for the 'enabled' setting? A limiter with
+	// no rate or an empty bucket would reject every request, so those values are
+	// refused outright.
+	cfg.limiter.rps = 2
+	flag.Func("limiter-rps", "Rate limiter maximum requests per second (default 2)", func(val string) error {
+		rps, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		if rps <= 0 || math.IsNaN(rps) || math.IsInf(rps, 0) {
+			return errors.New("must be a positive number")
+		}
+		cfg.limiter.rps = rps
+		return nil
+	})
+	cfg.limiter.burst = 4
+	flag.Func("limiter-burst", "Rate limiter maximum burst (default 4)", func(val string) error {
+		burst, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if burst < 1 {
+			return errors.New("must be at least 1")
+		}
+		cfg.limiter.burst = burst
+		return nil
+	})
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.limiter.trustedHeader, "limiter-trusted-header", "", "Header identifying clients behind a trusted network (e.g. X-Client-ID)")
+	flag.Func("limiter-trusted-networks", "Comma-separated CIDR ranges allowed to set the trusted header", func(val string) error {
+		networks, err := parseNetworks(val)
+		cfg.limiter.trustedNetworks = append(cfg.limiter.trustedNetworks, networks...)
+		return err
+	})
+
+	// Read the metrics settings. By default only the local machine can read the
+	// metrics from the API server.
+	flag.StringVar(&cfg.metrics.addr, "metrics-addr", "", "Separate listen address for /debug/metrics (e.g. 127.0.0.1:9090)")
+	flag.Func("metrics-allowed-networks", "Comma-separated CIDR ranges allowed to read /debug/metrics from the API server (default 127.0.0.0/8,::1/128)", func(val string) error {
+		networks, err := parseNetworks(val)
+		cfg.metrics.allowedNetworks = append(cfg.metrics.allowedNetworks, networks...)
+		return err
+	})
 
 	flag.Parse()
 
-	// Initialize a new logger which writes messages to the standard out stream,
-	// prefixed with the current date and time.
-	logger := log.New(os.Stdout, "", log.Ldate | log.Ltime)
+	if cfg.metrics.allowedNetworks == nil {
+		cfg.metrics.allowedNetworks, _ = parseNetworks("127.0.0.0/8,::1/128")
+	}
+
+	// Initialize a new jsonlog.Logger which writes any messages *at or above* the
+	// configured severity level to the standard out stream.
+	logger := jsonlog.New(os.Stdout, cfg.logLevel)
 
 
 	// Call the openDB() helper function (see below) to create the connection pool,
@@ -65,7 +173,7 @@ func main() {
 	// application immediately.
 	db, err := openDB(cfg)
 	if err != nil {
-		logger.Fatal(err)
+		logger.PrintFatal(err, nil)
 	}
 
 	// Defer a call to db.Close() so that the connection pool is closed before the
@@ -74,31 +182,22 @@ func main() {
 
 	// Also log a message to say that the connection pool has been successfully
 	// established.
-	logger.Printf("database connection pool established")
+	logger.PrintInfo("database connection pool established", nil)
 
 	app := &application {
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		config:  cfg,
+		logger:  logger,
+		models:  data.NewModels(db, cfg.db.timeouts),
+		metrics: newMetrics(db),
+		mailer:  mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 
-	// Declare a HTTP server with some sensible timeout settings, which listens on the
-	// port provided in the config struct and uses the servemux we created above as the
-	// handler.
-	srv := &http.Server{
-		Addr: 			fmt.Sprintf(":%d", cfg.port),
-		Handler: 		app.routes(),
-		IdleTimeout:	time.Minute,
-		ReadTimeout: 	10 * time.Second,
-		WriteTimeout: 	30 * time.Second,
+	// Call app.serve() to start the server. It returns once the server has been shut
+	// down gracefully.
+	err = app.serve()
+	if err != nil {
+		logger.PrintFatal(err, nil)
 	}
-	
-	// Start the HTTP server.
-	logger.Printf("starting %s server on %s", cfg.env, srv.Addr)
-	// Because the err variable is now already declared in the code above, we need
-	// to use the = operator here, instead of the := operator.
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
 }
 
 // The openDB() function returns a sql.DB connection pool.
@@ -125,4 +224,18 @@ func openDB(cfg config) (*sql.DB, error) {
 	// Return the sql.DB connection pool.
 	return db, nil
 }
-	
\ No newline at end of file
+	
+
+// The parseNetworks() function parses a comma-separated list of CIDR ranges, as used
+// by the command-line flags.
+func parseNetworks(val string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(val, ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"goproject/internal/metrics"
+)
+
+// appMetrics holds the metrics exposed on /debug/metrics: the HTTP request metrics
+// recorded by the recordMetrics() middleware, the state of the database connection
+// pool, and a few Go runtime statistics.
+type appMetrics struct {
+	registry         *metrics.Registry
+	requests         *metrics.CounterVec
+	requestsInFlight *metrics.GaugeVec
+	requestDuration  *metrics.HistogramVec
+}
+
+// The newMetrics() function creates the application metrics. The pool and runtime
+// statistics are read once per scrape, when the metrics are written.
+func newMetrics(db *sql.DB) *appMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry: registry,
+		requests: registry.NewCounterVec("http_requests_total",
+			"Number of HTTP requests handled, by route pattern, method and status code.", "route", "method", "code"),
+		requestsInFlight: registry.NewGaugeVec("http_requests_in_flight",
+			"Number of HTTP requests currently being handled, by route pattern.", "route"),
+		requestDuration: registry.NewHistogramVec("http_request_duration_seconds",
+			"Time taken to handle HTTP requests, by route pattern, method and status code.", metrics.DefaultBuckets, "route", "method", "code"),
+	}
+
+	var stats sql.DBStats
+	var mem runtime.MemStats
+	registry.OnCollect(func() {
+		stats = db.Stats()
+		runtime.ReadMemStats(&mem)
+	})
+
+	registry.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(stats.MaxOpenConnections) })
+	registry.NewGaugeFunc("db_open_connections", "Number of established connections, both in use and idle.",
+		func() float64 { return float64(stats.OpenConnections) })
+	registry.NewGaugeFunc("db_in_use_connections", "Number of connections currently in use.",
+		func() float64 { return float64(stats.InUse) })
+	registry.NewGaugeFunc("db_idle_connections", "Number of idle connections.",
+		func() float64 { return float64(stats.Idle) })
+	registry.NewCounterFunc("db_wait_count_total", "Number of connections waited for.",
+		func() float64 { return float64(stats.WaitCount) })
+	registry.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for new connections.",
+		func() float64 { return stats.WaitDuration.Seconds() })
+	registry.NewCounterFunc("db_max_idle_closed_total", "Number of connections closed due to SetMaxIdleConns.",
+		func() float64 { return float64(stats.MaxIdleClosed) })
+	registry.NewCounterFunc("db_max_idle_time_closed_total", "Number of connections closed due to SetConnMaxIdleTime.",
+		func() float64 { return float64(stats.MaxIdleTimeClosed) })
+	registry.NewCounterFunc("db_max_lifetime_closed_total", "Number of connections closed due to SetConnMaxLifetime.",
+		func() float64 { return float64(stats.MaxLifetimeClosed) })
+
+	registry.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	registry.NewGaugeFunc("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.",
+		func() float64 { return float64(mem.Alloc) })
+	registry.NewGaugeFunc("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.",
+		func() float64 { return float64(mem.HeapInuse) })
+	registry.NewGaugeFunc("go_memstats_sys_bytes", "Number of bytes obtained from the system.",
+		func() float64 { return float64(mem.Sys) })
+	registry.NewCounterFunc("go_memstats_mallocs_total", "Total number of heap objects allocated.",
+		func() float64 { return float64(mem.Mallocs) })
+	registry.NewCounterFunc("go_gc_cycles_total", "Number of completed GC cycles.",
+		func() float64 { return float64(mem.NumGC) })
+	registry.NewCounterFunc("go_gc_pause_seconds_total", "Total time the program has been stopped for GC.",
+		func() float64 { return time.Duration(mem.PauseTotalNs).Seconds() })
+
+	return m
+}
+
+// Define a routeContextKey, used for the route pattern a request was routed to.
+const routeContextKey = contextKey("route")
+
+// unmatchedRoute is the route label of requests that never reached one of our routes,
+// such as 404s, or requests rejected by the rate limiter.
+const unmatchedRoute = "none"
+
+// metricsResponseWriter wraps a http.ResponseWriter to record the status code of the
+// response.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+	mw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	return mw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original http.ResponseWriter, so that http.ResponseController
+// still works for handlers further down the chain.
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// The recordMetrics() middleware records the number of requests and the time taken to
+// handle them, labelled with the route pattern, method and status code. It goes in
+// front of all the other middleware, so that requests they reject are counted too. The
+// route pattern is only known once the router has run, so the middleware leaves a
+// pointer in the request context for the instrumentRoute() wrapper to fill in.
+func (app *application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := unmatchedRoute
+
+		mw := &metricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		ctx := context.WithValue(r.Context(), routeContextKey, &route)
+
+		next.ServeHTTP(mw, r.WithContext(ctx))
+
+		method := methodLabel(r.Method)
+		code := strconv.Itoa(mw.statusCode)
+		app.metrics.requests.Inc(route, method, code)
+		app.metrics.requestDuration.Observe(time.Since(start).Seconds(), route, method, code)
+	})
+}
+
+// The methodLabel() function returns the method label of a request. Clients can send
+// any method they like, so anything other than the standard methods is recorded as
+// "OTHER", rather than creating a new series for every method name we are sent.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// The instrumentRoute() method wraps the handler of a route, so that the
+// recordMetrics() middleware knows which route pattern a request was handled by. It
+// also keeps track of the requests currently being handled by the route.
+func (app *application) instrumentRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeContextKey).(*string); ok {
+			*route = pattern
+		}
+
+		app.metrics.requestsInFlight.Add(1, pattern)
+		defer app.metrics.requestsInFlight.Add(-1, pattern)
+
+		next(w, r)
+	}
+}
+
+// The metricsHandler() handles "GET /debug/metrics", writing all the metrics in the
+// Prometheus text exposition format.
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	_, err := app.metrics.registry.WriteTo(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// The requireMetricsAccess() middleware only lets clients from one of the configured
+// metrics networks through. Everyone else gets a 404, as if the endpoint didn't exist.
+// The client address is always taken from the connection, never from a header.
+func (app *application) requireMetricsAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		ip := net.ParseIP(host)
+		for _, network := range app.config.metrics.allowedNetworks {
+			if network.Contains(ip) {
+				next(w, r)
+				return
+			}
+		}
+
+		app.notFoundResponse(w, r)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goproject/internal/jsonlog"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func newTestMetricsApp(t *testing.T) *application {
+	t.Helper()
+
+	// sql.Open() doesn't connect to anything, but gives the pool statistics something
+	// to read.
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &application{
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelOff),
+		metrics: newMetrics(db),
+	}
+}
+
+// metricSamples returns the value of every sample in the application's metrics, keyed
+// by the metric name and labels, as written on /debug/metrics.
+func metricSamples(t *testing.T, app *application) map[string]string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if _, err := app.metrics.registry.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		samples[line[:i]] = line[i+1:]
+	}
+	return samples
+}
+
+func TestRecordMetrics(t *testing.T) {
+	app := newTestMetricsApp(t)
+
+	var inFlight string
+	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	router.HandlerFunc(http.MethodGet, "/v1/songs/:id", app.instrumentRoute("/v1/songs/:id", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = metricSamples(t, app)[`http_requests_in_flight{route="/v1/songs/:id"}`]
+		w.Write([]byte("OK"))
+	}))
+	router.HandlerFunc(http.MethodPost, "/v1/songs", app.instrumentRoute("/v1/songs", func(w http.ResponseWriter, r *http.Request) {
+		// Only the first status code counts.
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	handler := app.recordMetrics(router)
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/v1/songs/1"},
+		{http.MethodGet, "/v1/songs/2"},
+		{http.MethodPost, "/v1/songs"},
+		{http.MethodGet, "/v1/albums"},
+		{"BREW", "/v1/songs/1"},
+		{"PROPFIND", "/v1/songs/1"},
+	}
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	if inFlight != "1" {
+		t.Errorf("got %q requests in flight while handling one; want 1", inFlight)
+	}
+
+	samples := metricSamples(t, app)
+	want := map[string]string{
+		`http_requests_total{route="/v1/songs/:id",method="GET",code="200"}`:                 "2",
+		`http_requests_total{route="/v1/songs",method="POST",code="201"}`:                    "1",
+		`http_requests_total{route="none",method="GET",code="404"}`:                          "1",
+		`http_requests_total{route="none",method="OTHER",code="405"}`:                        "2",
+		`http_request_duration_seconds_count{route="/v1/songs/:id",method="GET",code="200"}`: "2",
+		`http_request_duration_seconds_count{route="none",method="OTHER",code="405"}`:        "2",
+		`http_requests_in_flight{route="/v1/songs/:id"}`:                                     "0",
+		`http_requests_in_flight{route="/v1/songs"}`:                                         "0",
+	}
+	for key, value := range want {
+		if samples[key] != value {
+			t.Errorf("%s: got %q; want %q", key, samples[key], value)
+		}
+	}
+
+	for key := range samples {
+		if strings.Contains(key, "BREW") || strings.Contains(key, "PROPFIND") {
+			t.Errorf("unexpected series for a non-standard method: %s", key)
+		}
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	tests := map[string]string{
+		http.MethodGet:    http.MethodGet,
+		http.MethodPatch:  http.MethodPatch,
+		http.MethodDelete: http.MethodDelete,
+		"get":             "OTHER",
+		"BREW":            "OTHER",
+		"":                "OTHER",
+	}
+	for method, want := range tests {
+		if got := methodLabel(method); got != want {
+			t.Errorf("methodLabel(%q) = %q; want %q", method, got, want)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goproject/internal/data"
+	"goproject/internal/validator"
+
+	"golang.org/x/time/rate"
+)
+
+// The requestID() middleware gives every request an ID, so that a failing call reported
+// by a client can be found in our logs. A client (or a proxy in front of us) can send
+// its own ID in the X-Request-ID header, otherwise a random one is generated. The ID is
+// stored in the request context and echoed in the X-Request-ID response header.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// IDs we can't safely put in a log line or a SQL comment are replaced, rather
+		// than rejecting the request.
+		id := r.Header.Get("X-Request-ID")
+		if !data.ValidRequestID(id) {
+			var err error
+			id, err = generateRequestID()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// The generateRequestID() helper returns a random 128-bit request ID, hex encoded.
+func generateRequestID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// The recoverPanic() middleware turns a panic in any handler (or in the middleware it
+// wraps) into the usual 500 Internal Server Error JSON response, instead of the
+// connection being dropped without a body. The panic is logged with its stack trace
+// and the details of the request.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Create a deferred function (which will always be run in the event of a panic
+		// as Go unwinds the stack).
+		defer func() {
+			// Use the builtin recover function to check if there has been a panic or
+			// not.
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler is used on purpose to abort a response, so let
+				// net/http deal with it as usual.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				// If there was a panic, set a "Connection: close" header on the
+				// response. This acts as a trigger to make Go's HTTP server
+				// automatically close the current connection after a response has been
+				// sent.
+				w.Header().Set("Connection", "close")
+
+				// The value returned by recover() has the type interface{}, so we use
+				// fmt.Errorf() to normalize it into an error and call our
+				// serverErrorResponse() helper. In turn, this will log the error, along
+				// with the request and the stack trace, and send the client a 500
+				// Internal Server Error response.
+				app.serverErrorResponse(w, r, fmt.Errorf("panic: %v", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The authenticate() middleware resolves the bearer token in the Authorization header
+// into a user, and stores it in the request context. Requests without the header get
+// the AnonymousUser, so that handlers can always call contextGetUser().
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Add the "Vary: Authorization" header to the response. This indicates to any
+		// caches that the response may vary based on the value of the Authorization
+		// header in the request.
+		w.Header().Add("Vary", "Authorization")
+
+		// Requests authenticated with an API key already carry their user.
+		if app.contextGetApiKey(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Retrieve the value of the Authorization header from the request. This will
+		// return the empty string "" if there is no such header found.
+		authorizationHeader := r.Header.Get("Authorization")
+
+		// If there is no Authorization header found, use the contextSetUser() helper
+		// that we just made to add the AnonymousUser to the request context. Then we
+		// call the next handler in the chain and return without executing any of the
+		// code below.
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Otherwise, we expect the value of the Authorization header to be in the format
+		// "Bearer <token>". We try to split this into its constituent parts, and if the
+		// header isn't in the expected format we return a 401 Unauthorized response
+		// using the invalidAuthenticationTokenResponse() helper.
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || !strings.EqualFold(headerParts[0], "Bearer") {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Extract the actual authentication token from the header parts.
+		token := headerParts[1]
+
+		// Validate the token to make sure it is in a sensible format.
+		v := validator.New()
+
+		// If the token isn't valid, use the invalidAuthenticationTokenResponse() helper
+		// to send a response, rather than the failedValidationResponse() helper that
+		// we'd normally use.
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Retrieve the details of the user associated with the authentication token,
+		// again calling the invalidAuthenticationTokenResponse() helper if no matching
+		// record was found. Expired tokens are not found either.
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// Call the contextSetUser() helper to add the user information to the request
+		// context.
+		r = app.contextSetUser(r, user)
+
+		// Call the next handler in the chain.
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthenticatedUser() middleware checks that the user is not anonymous.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireActivatedUser() middleware checks that a user is both authenticated and
+// activated.
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	// Rather than returning this http.HandlerFunc we assign it to the variable fn.
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		// Check that a user is activated.
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	// Wrap fn with the requireAuthenticatedUser() middleware before returning it.
+	return app.requireAuthenticatedUser(fn)
+}
+
+// The requirePermission() middleware checks that the user has the given permission
+// code. Note that the first parameter for the middleware function is the permission
+// code that we require the user to have.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the user from the request context.
+		user := app.contextGetUser(r)
+
+		// Get the slice of permissions for the user. API keys carry their own
+		// permissions instead.
+		var permissions data.Permissions
+		if key := app.contextGetApiKey(r); key != nil {
+			permissions = key.Permissions
+		} else {
+			var err error
+			permissions, err = app.models.Permissions.GetAllForUser(r.Context(), user.Id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		// Check if the slice includes the required permission. If it doesn't, then
+		// return a 403 Forbidden response.
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		// Otherwise they have the required permission so we call the next handler in
+		// the chain.
+		next.ServeHTTP(w, r)
+	}
+
+	// Wrap this with the requireActivatedUser() middleware before returning it.
+	return app.requireActivatedUser(fn)
+}
+
+// The authenticateApiKey() middleware accepts an API key in the X-API-Key header. A
+// valid key is stored in the request context together with the user it acts as, and
+// every use of it is logged. It wraps the router, so it runs before authenticate().
+func (app *application) authenticateApiKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "X-API-Key")
+
+		keyPlaintext := r.Header.Get("X-API-Key")
+		if keyPlaintext == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateApiKeyPlaintext(v, keyPlaintext); !v.Valid() {
+			app.invalidApiKeyResponse(w, r)
+			return
+		}
+
+		// Expired and revoked keys are not found. Looking the key up also records it as
+		// used.
+		key, err := app.models.ApiKeys.GetForPlaintext(r.Context(), keyPlaintext)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidApiKeyResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.logger.PrintInfo("api key used", map[string]string{
+			"apiKeyId":      strconv.FormatInt(key.Id, 10),
+			"apiKeyName":    key.Name,
+			"apiKeyPrefix":  key.Prefix,
+			"requestMethod": r.Method,
+			"requestUrl":    r.URL.String(),
+		})
+
+		next.ServeHTTP(w, app.contextSetApiKey(r, key))
+	})
+}
+
+// The rateLimit() middleware limits every client to cfg.limiter.rps requests per
+// second, with bursts of up to cfg.limiter.burst requests, using a token bucket per
+// client. Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers describing the client's quota. Clients that haven't been seen for a while
+// are forgotten by a background goroutine, which runs until ctx is canceled.
+func (app *application) rateLimit(ctx context.Context, next http.Handler) http.Handler {
+	// If rate limiting is disabled, there is nothing to do, and nothing to clean up.
+	if !app.config.limiter.enabled {
+		return next
+	}
+
+	// Define a client struct to hold the rate limiter and last seen time for each
+	// client.
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+
+	// Declare a mutex and a map to hold the clients' IP addresses and rate limiters.
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*client)
+	)
+
+	// Launch a background goroutine which removes old entries from the clients map once
+	// every minute, until the server shuts down.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// Lock the mutex to prevent any rate limiter checks from happening while
+			// the cleanup is taking place.
+			mu.Lock()
+
+			// Loop through all clients. If they haven't been seen within the last three
+			// minutes, delete the corresponding entry from the map.
+			for key, client := range clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(clients, key)
+				}
+			}
+
+			// Importantly, unlock the mutex when the cleanup is complete.
+			mu.Unlock()
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := app.rateLimitKey(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Lock the mutex to prevent this code from being executed concurrently.
+		mu.Lock()
+
+		// Check to see if the client already exists in the map. If it doesn't, then
+		// initialize a new rate limiter and add the client to the map.
+		if _, found := clients[key]; !found {
+			clients[key] = &client{
+				limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+			}
+		}
+
+		// Update the last seen time for the client.
+		clients[key].lastSeen = time.Now()
+
+		// Take a token from the client's bucket, and find out how many are left.
+		limiter := clients[key].limiter
+		allowed := limiter.Allow()
+		tokens := limiter.Tokens()
+
+		// Very importantly, unlock the mutex before calling the next handler in the
+		// chain.
+		mu.Unlock()
+
+		rps := app.config.limiter.rps
+		burst := app.config.limiter.burst
+
+		// RateLimit-Reset is the number of seconds until the bucket is full again.
+		w.Header().Set("RateLimit-Limit", fmt.Sprintf("%d", burst))
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d", int(math.Max(0, math.Floor(tokens)))))
+		w.Header().Set("RateLimit-Reset", fmt.Sprintf("%d", int(math.Ceil((float64(burst)-tokens)/rps))))
+
+		// If the request isn't allowed, tell the client how long it has to wait for
+		// the next token.
+		if !allowed {
+			retryAfter := time.Duration(math.Ceil((1-tokens)/rps)) * time.Second
+			app.rateLimitExceededResponse(w, r, retryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The rateLimitKey() helper returns the key a request is rate limited by. This is the
+// client's IP address, unless the request comes from one of the trusted networks and
+// carries the trusted header, in which case the header value identifies the client.
+func (app *application) rateLimitKey(r *http.Request) (string, error) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	if header := app.config.limiter.trustedHeader; header != "" {
+		if value := r.Header.Get(header); value != "" && app.trustedIP(net.ParseIP(ip)) {
+			return "header:" + value, nil
+		}
+	}
+
+	return "ip:" + ip, nil
+}
+
+// Report whether an IP address belongs to one of the trusted networks.
+func (app *application) trustedIP(ip net.IP) bool {
+	for _, network := range app.config.limiter.trustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,7 +5,8 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) routes() *httprouter.Router {
+// Update the routes() method to return a http.Handler instead of a *httprouter.Router.
+func (app *application) routes() http.Handler {
 	// Initialize a new httprouter router instance.
 	router := httprouter.New()
 
@@ -18,18 +19,68 @@ func (app *application) routes() *httprouter.Router {
 	// it as the custom error handler for 405 Method Not Allowed responses.
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
+	// Every route is registered through handle(), which wraps the handler with
+	// instrumentRoute() so that its requests are recorded under the route pattern.
+	handle := func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, app.instrumentRoute(pattern, handler))
+	}
+
+	// The songs, groups, singers and albums endpoints are only available to activated
+	// users with the matching permission: "<resource>:read" for GET requests and
+	// "<resource>:write" for everything else. The requirePermission() middleware checks
+	// both.
+	//
 	// Register the relevant methods, URL patterns and handler functions for our
-	// endpoints using the HandlerFunc() method. Note that http.MethodGet and
+	// endpoints using the handle() helper. Note that http.MethodGet and
 	// http.MethodPost are constants which equate to the strings "GET" and "POST"
 	// respectively.
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+
+	handle(http.MethodGet, "/v1/songs", app.requirePermission("songs:read", app.listSongsHandler))
+	handle(http.MethodPost, "/v1/songs", app.requirePermission("songs:write", app.createSongHandler))
+	handle(http.MethodGet, "/v1/songs/:id", app.requirePermission("songs:read", app.showSongHandler))
+	handle(http.MethodPut, "/v1/songs/:id", app.requirePermission("songs:write", app.updateSongHandler))
+	handle(http.MethodPatch, "/v1/songs/:id", app.requirePermission("songs:write", app.patchSongHandler))
+	handle(http.MethodDelete, "/v1/songs/:id", app.requirePermission("songs:write", app.deleteSongHandler))
+
+	handle(http.MethodGet, "/v1/groups", app.requirePermission("groups:read", app.listGroupsHandler))
+	handle(http.MethodPost, "/v1/groups", app.requirePermission("groups:write", app.createGroupHandler))
+	handle(http.MethodGet, "/v1/groups/:id", app.requirePermission("groups:read", app.showGroupHandler))
+	handle(http.MethodPut, "/v1/groups/:id", app.requirePermission("groups:write", app.updateGroupHandler))
+	handle(http.MethodDelete, "/v1/groups/:id", app.requirePermission("groups:write", app.deleteGroupHandler))
+	handle(http.MethodGet, "/v1/groups/:id/members", app.requirePermission("groups:read", app.listGroupMembersHandler))
+	handle(http.MethodGet, "/v1/groups/:id/discography", app.requirePermission("groups:read", app.showGroupDiscographyHandler))
+
+	handle(http.MethodGet, "/v1/singers", app.requirePermission("singers:read", app.listSingersHandler))
+	handle(http.MethodPost, "/v1/singers", app.requirePermission("singers:write", app.createSingerHandler))
+	handle(http.MethodGet, "/v1/singers/:id", app.requirePermission("singers:read", app.showSingerHandler))
+	handle(http.MethodPut, "/v1/singers/:id", app.requirePermission("singers:write", app.updateSingerHandler))
+	handle(http.MethodDelete, "/v1/singers/:id", app.requirePermission("singers:write", app.deleteSingerHandler))
+
+	handle(http.MethodGet, "/v1/albums", app.requirePermission("albums:read", app.listAlbumsHandler))
+	handle(http.MethodPost, "/v1/albums", app.requirePermission("albums:write", app.createAlbumHandler))
+	handle(http.MethodGet, "/v1/albums/:id", app.requirePermission("albums:read", app.showAlbumHandler))
+	handle(http.MethodPut, "/v1/albums/:id", app.requirePermission("albums:write", app.updateAlbumHandler))
+	handle(http.MethodDelete, "/v1/albums/:id", app.requirePermission("albums:write", app.deleteAlbumHandler))
+	handle(http.MethodGet, "/v1/albums/:id/songs", app.requirePermission("albums:read", app.listAlbumSongsHandler))
+
+	handle(http.MethodPost, "/v1/users", app.registerUserHandler)
+	handle(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
+	// API keys for service-to-service clients are managed by admins.
+	handle(http.MethodGet, "/v1/apikeys", app.requirePermission("apikeys:admin", app.listApiKeysHandler))
+	handle(http.MethodPost, "/v1/apikeys", app.requirePermission("apikeys:admin", app.createApiKeyHandler))
+	handle(http.MethodPost, "/v1/apikeys/:id/rotate", app.requirePermission("apikeys:admin", app.rotateApiKeyHandler))
+	handle(http.MethodDelete, "/v1/apikeys/:id", app.requirePermission("apikeys:admin", app.revokeApiKeyHandler))
 
-	router.HandlerFunc(http.MethodGet, "/v1/songs", app.listSongsHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/songs", app.createSongHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/songs/:id", app.showSongHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/songs/:id", app.updateSongHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/songs/:id", app.deleteSongHandler)
+	// The metrics are served here too, unless they have a listen address of their own.
+	if app.config.metrics.addr == "" {
+		handle(http.MethodGet, "/debug/metrics", app.requireMetricsAccess(app.metricsHandler))
+	}
 
-	// Return the httprouter instance.
-	return router
+	// Wrap the router with the authenticate() middleware, so that every handler finds
+	// the user (or the AnonymousUser) in the request context.
+	return app.authenticate(router)
 }
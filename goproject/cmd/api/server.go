@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// The serve() method starts the HTTP server and blocks until it has been shut down.
+// On SIGINT or SIGTERM it stops accepting new connections, gives in-flight requests
+// and background tasks up to cfg.shutdownTimeout to finish, and then returns.
+func (app *application) serve() error {
+	// Background work started by the middleware, such as the rate limiter's cleanup of
+	// old clients, runs until serve() returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Declare a HTTP server with some sensible timeout settings, which listens on the
+	// port provided in the config struct and uses the router from app.routes(), wrapped
+	// in our middleware, as the handler.
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.recordMetrics(app.requestID(app.recoverPanic(app.rateLimit(ctx, app.authenticateApiKey(app.routes()))))),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		// Create a new Go log.Logger instance with the log.New() function, passing in
+		// our custom Logger as the first parameter. The "" and 0 indicate that the
+		// log.Logger instance should not use a prefix or any flags.
+		ErrorLog: log.New(app.logger, "", 0),
+	}
+
+	// If the metrics have a listen address of their own, start a second server for
+	// them. It is only reachable by whoever can reach that address, so it isn't
+	// restricted any further.
+	var metricsSrv *http.Server
+	if app.config.metrics.addr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/metrics", app.metricsHandler)
+
+		metricsSrv = &http.Server{
+			Addr:         app.config.metrics.addr,
+			Handler:      mux,
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			ErrorLog:     log.New(app.logger, "", 0),
+		}
+
+		go func() {
+			app.logger.PrintInfo("starting metrics server", map[string]string{
+				"addr": metricsSrv.Addr,
+			})
+
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{
+					"addr": metricsSrv.Addr,
+				})
+			}
+		}()
+	}
+
+	// Create a shutdownError channel. We will use this to receive any errors returned
+	// by the graceful Shutdown() function.
+	shutdownError := make(chan error)
+
+	// Start a background goroutine.
+	go func() {
+		// Create a quit channel which carries os.Signal values.
+		quit := make(chan os.Signal, 1)
+
+		// Use signal.Notify() to listen for incoming SIGINT and SIGTERM signals and
+		// relay them to the quit channel. Any other signals will not be caught by
+		// signal.Notify() and will retain their default behavior.
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		// Read the signal from the quit channel. This code will block until a signal is
+		// received.
+		s := <-quit
+
+		// Log a message to say that the signal has been caught.
+		app.logger.PrintInfo("shutting down server", map[string]string{
+			"signal": s.String(),
+		})
+
+		// Create a context with the configured timeout.
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+
+		// Call Shutdown() on the server like before, but now we only send on the
+		// shutdownError channel if it returns an error.
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		// The metrics server is shut down after the API server, so that it can still
+		// be scraped while the last requests finish.
+		if metricsSrv != nil {
+			err = metricsSrv.Shutdown(ctx)
+			if err != nil {
+				shutdownError <- err
+				return
+			}
+		}
+
+		// Log a message to say that we're waiting for any background goroutines to
+		// complete their tasks.
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": srv.Addr,
+		})
+
+		// Wait for the background goroutines to finish, but no longer than what is
+		// left of the shutdown deadline.
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			shutdownError <- nil
+		case <-ctx.Done():
+			shutdownError <- fmt.Errorf("background tasks: %w", ctx.Err())
+		}
+	}()
+
+	// Likewise log a "starting server" message.
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": srv.Addr,
+		"env":  app.config.env,
+	})
+
+	// Calling Shutdown() on our server will cause ListenAndServe() to immediately
+	// return a http.ErrServerClosed error. So if we see this error, it is actually a
+	// good thing and an indication that the graceful shutdown has started. So we check
+	// specifically for this, only returning the error if it is NOT
+	// http.ErrServerClosed.
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Otherwise, we wait to receive the return value from Shutdown() on the
+	// shutdownError channel. If return value is an error, we know that there was a
+	// problem with the graceful shutdown and we return the error.
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	// At this point we know that the graceful shutdown completed successfully and we
+	// log a "stopped server" message.
+	app.logger.PrintInfo("stopped server", map[string]string{
+		"addr": srv.Addr,
+	})
+
+	return nil
+}
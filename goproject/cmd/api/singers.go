@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"goproject/internal/data"
+	"goproject/internal/validator"
+)
+
+func (app *application) createSingerHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FirstName string    `json:"firstName"`
+		LastName  string    `json:"lastName"`
+		Birthday  data.Date `json:"birthday"`
+		GroupId   *int      `json:"groupId"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	singer := &data.Singer{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Birthday:  input.Birthday,
+		GroupId:   input.GroupId,
+	}
+
+	v := validator.New()
+
+	data.ValidateSinger(v, singer)
+	if singer.GroupId != nil {
+		err = app.checkGroupReference(r.Context(), v, "groupId", *singer.GroupId)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Singers.Insert(r.Context(), singer)
+	if err != nil {
+		switch {
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/singers/%d", singer.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"singer": singer}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showSingerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v, singerFieldSafelist, singerIncludeSafelist)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	singer, err := app.models.Singers.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	shaped, err := app.shapeSingers(r.Context(), []*data.Singer{singer}, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"singer": shaped[0]}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSingerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	singer, err := app.models.Singers.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		FirstName string    `json:"firstName"`
+		LastName  string    `json:"lastName"`
+		Birthday  data.Date `json:"birthday"`
+		GroupId   *int      `json:"groupId"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	singer.FirstName = input.FirstName
+	singer.LastName = input.LastName
+	singer.Birthday = input.Birthday
+	singer.GroupId = input.GroupId
+
+	v := validator.New()
+
+	data.ValidateSinger(v, singer)
+	if singer.GroupId != nil {
+		err = app.checkGroupReference(r.Context(), v, "groupId", *singer.GroupId)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Singers.Update(r.Context(), singer)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"singer": singer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSingerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Singers.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "singer successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSingersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string
+		GroupId int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.GroupId = app.readInt(qs, "group_id", 0, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "firstName", "lastName", "birthday", "-id", "-firstName", "-lastName", "-birthday",
+		"group.name", "-group.name"}
+	input.Filters.Filter = app.readString(qs, "filter", "")
+	input.Filters.FilterSafelist = data.SingerFilterSafelist
+	fs := app.readFieldset(qs, v, singerFieldSafelist, singerIncludeSafelist)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	singers, metadata, err := app.models.Singers.GetAll(r.Context(), input.Name, input.GroupId, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shaped, err := app.shapeSingers(r.Context(), singers, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"singers": shaped, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listGroupMembersHandler() handles "GET /v1/groups/:id/members" and returns the
+// roster of a single group. A 404 is sent if the group itself doesn't exist, so that
+// clients can tell an unknown group apart from one with no members.
+func (app *application) listGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v, singerFieldSafelist, singerIncludeSafelist)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Groups.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	singers, err := app.models.Singers.GetAllForGroup(r.Context(), id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shaped, err := app.shapeSingers(r.Context(), singers, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": shaped}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
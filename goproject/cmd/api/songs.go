@@ -1,21 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
 	"errors"
 
 	"goproject/internal/data"
+	"goproject/internal/patch"
 	"goproject/internal/validator"
 )
 
 
 func (app *application) createSongHandler(w http.ResponseWriter, r *http.Request) {
+	// Song IDs are generated by the database, so there is deliberately no id field
+	// here. Because readJSON() disallows unknown fields, a request that still sends
+	// an id is rejected with a 400 Bad Request rather than silently ignored.
 	var input struct {
-		Id       int 	`json:"id"`
 		Title    string `json:"title"`
-		Length   int    `json:"length"`
+		Length   *int   `json:"length"`
 		Album_id int    `json:"albumId"`
+		TrackNumber *int `json:"trackNumber"`
 	}
 
 	// Initialize a new json.Decoder instance which reads from the request body, and
@@ -33,18 +40,24 @@ func (app *application) createSongHandler(w http.ResponseWriter, r *http.Request
 	// Copy the values from the input struct to a new Song struct.
 
 	song := &data.Song{
-		Id:       input.Id,
 		Title:    input.Title,
 		Length:   input.Length,
 		Album_id: input.Album_id,
+		TrackNumber: input.TrackNumber,
 	}
 
 	// Initialize a new Validator instance.
 	v := validator.New()
 
 	// Call the ValidateSong() function and return a response containing the errors if
-	// any of the checks fail.
-	if data.ValidateSong(v, song); !v.Valid() {
+	// any of the checks fail. The album the song belongs to is checked as well.
+	data.ValidateSong(v, song)
+	err = app.checkSongAlbum(r.Context(), v, song)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -53,10 +66,15 @@ func (app *application) createSongHandler(w http.ResponseWriter, r *http.Request
 	// Call the Insert() method on our songs model, passing in a pointer to the
 	// validated song struct. This will create a record in the database and update the
 	// song struct with the system-generated information.
-	err = app.models.Songs.Insert(song)
+	err = app.models.Songs.Insert(r.Context(), song)
 
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -66,6 +84,7 @@ func (app *application) createSongHandler(w http.ResponseWriter, r *http.Request
 	// interpolating the system-generated ID for our new movie in the URL.
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/songs/%d", song.Id))
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, song.Version))
 	// Write a JSON response with a 201 Created status code, the song data in the
 	// response body, and the Location header.
 
@@ -99,11 +118,20 @@ func (app *application) showSongHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}	
 
+	// The fields and include parameters trim the song and embed its album (and the
+	// album's group) in the response.
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v, songFieldSafelist, songIncludeSafelist)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Call the Get() method to fetch the data for a specific movie. We also need to
 	// use the errors.Is() function to check if it returns a data.ErrRecordNotFound
 	// error, in which case we send a 404 Not Found response to the client.
-	// movie, err := app.models.Movies.Get(id)
-	song, err := app.models.Songs.Get(id)
+	// movie, err := app.models.Movies.Get(r.Context(), id)
+	song, err := app.models.Songs.Get(r.Context(), id)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -115,9 +143,20 @@ func (app *application) showSongHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	
+	// Include the current version as an ETag, so that clients can send it back in an
+	// If-Match header when they update the song.
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, song.Version))
+
+	shaped, err := app.shapeSongs(r.Context(), []*data.Song{song}, fs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Encode the struct to JSON and send it as the HTTP response.
 	// err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
-	err = app.writeJSON(w, http.StatusOK, envelope{"song": song}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"song": shaped[0]}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -133,8 +172,8 @@ func (app *application) updateSongHandler(w http.ResponseWriter, r *http.Request
 	}
 	// Fetch the existing movie record from the database, sending a 404 Not Found
 	// response to the client if we couldn't find a matching record.
-	// movie, err := app.models.Movies.Get(id)
-	song, err := app.models.Songs.Get(id)
+	// movie, err := app.models.Movies.Get(r.Context(), id)
+	song, err := app.models.Songs.Get(r.Context(), id)
 	
 	if err != nil {
 		switch {
@@ -146,12 +185,26 @@ func (app *application) updateSongHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// If the request contains an If-Match header, check that the song version in the
+	// database still matches it. If it doesn't, the client is working from a stale copy
+	// of the record and we send it a 409 Conflict straight away.
+	expectedVersion, ok, err := app.readIfMatchVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if ok && expectedVersion != song.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
 	// Declare an input struct to hold the expected data from the client.
 
 	var input struct {
 		Title    string `json:"title"`
-		Length   int    `json:"length"`
+		Length   *int   `json:"length"`
 		Album_id int    `json:"albumId"`
+		TrackNumber *int `json:"trackNumber"`
 	}
 
 	// Read the JSON request body data into the input struct.
@@ -167,6 +220,7 @@ func (app *application) updateSongHandler(w http.ResponseWriter, r *http.Request
 	song.Title = input.Title
 	song.Length = input.Length
 	song.Album_id = input.Album_id
+	song.TrackNumber = input.TrackNumber
 
 	// Validate the updated movie record, sending the client a 422 Unprocessable Entity
 	// response if any checks fail.
@@ -175,21 +229,167 @@ func (app *application) updateSongHandler(w http.ResponseWriter, r *http.Request
 	// 	app.failedValidationResponse(w, r, v.Errors)
 	// 	return
 	// }
-	if data.ValidateSong(v, song); !v.Valid() {
+	data.ValidateSong(v, song)
+	err = app.checkSongAlbum(r.Context(), v, song)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// Pass the updated movie record to our new Update() method.
-	err = app.models.Songs.Update(song)
+	// Pass the updated movie record to our new Update() method. An ErrEditConflict here
+	// means another request changed the song between our Get() and Update() calls.
+	err = app.models.Songs.Update(r.Context(), song)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, song.Version))
+
 	// Write the updated movie record in a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"song": song}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"song": song}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The patchSongHandler() handles "PATCH /v1/songs/:id". Unlike the PUT handler, fields
+// which aren't mentioned in the request are left untouched. The request body can be
+// either a JSON Merge Patch (RFC 7396, Content-Type: application/merge-patch+json) or a
+// JSON Patch (RFC 6902, Content-Type: application/json-patch+json). Plain
+// application/json bodies are treated as merge patches.
+func (app *application) patchSongHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !(contentType == patch.MergePatchContentType || contentType == patch.JSONPatchContentType || contentType == "application/json") {
+		app.unsupportedMediaTypeResponse(w, r, patch.MergePatchContentType, patch.JSONPatchContentType)
+		return
+	}
+
+	song, err := app.models.Songs.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	expectedVersion, ok, err := app.readIfMatchVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if ok && expectedVersion != song.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var body json.RawMessage
+	err = app.readJSON(w, r, &body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// The patch is applied to a document holding only the fields a client is allowed to
+	// change, so a patch can't touch the id or version.
+	type songFields struct {
+		Title       string `json:"title"`
+		Length      *int   `json:"length"`
+		Album_id    int    `json:"albumId"`
+		TrackNumber *int   `json:"trackNumber"`
+	}
 
+	doc, err := json.Marshal(songFields{
+		Title:       song.Title,
+		Length:      song.Length,
+		Album_id:    song.Album_id,
+		TrackNumber: song.TrackNumber,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var patched []byte
+	switch contentType {
+	case patch.JSONPatchContentType:
+		patched, err = patch.ApplyJSONPatch(doc, body)
+	default:
+		patched, err = patch.MergePatch(doc, body)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Decode the patched document back, rejecting any keys the patch added which don't
+	// correspond to an editable field.
+	var fields songFields
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&fields)
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("patched song is invalid: %w", err))
+		return
+	}
+
+	song.Title = fields.Title
+	song.Length = fields.Length
+	song.Album_id = fields.Album_id
+	song.TrackNumber = fields.TrackNumber
+
+	// The merged result goes through exactly the same checks as a full update.
+	v := validator.New()
+	data.ValidateSong(v, song)
+	err = app.checkSongAlbum(r.Context(), v, song)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Songs.Update(r.Context(), song)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, new(*data.ConstraintError)):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, song.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"song": song}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -206,7 +406,7 @@ func (app *application) deleteSongHandler(w http.ResponseWriter, r *http.Request
 
 	// Delete the song from the database, sending a 404 Not Found response to the
 	// client if there isn't a matching record.
-	err = app.models.Songs.Delete(id)
+	err = app.models.Songs.Delete(r.Context(), id)
 
 	if err != nil {
 		switch {
@@ -231,6 +431,8 @@ func (app *application) listSongsHandler(w http.ResponseWriter, r *http.Request)
 	var input struct {
 		Title    string `json:"title"`
 		Length   int    `json:"length"`
+		HasLength *bool `json:"has_length"`
+		Facets   []string `json:"facets"`
 		data.Filters
 	}
 
@@ -246,7 +448,9 @@ func (app *application) listSongsHandler(w http.ResponseWriter, r *http.Request)
 	input.Title = app.readString(qs, "title", "")
 
 
-	input.Length = app.readInt(qs, "length", 1, v)
+	input.Length = app.readInt(qs, "length", 0, v)
+	// Songs with an unknown length can be included or excluded explicitly.
+	input.HasLength = app.readBool(qs, "has_length", v)
 	
 
 	// Get the page and page_size query string values as integers. Notice that we set
@@ -255,14 +459,30 @@ func (app *application) listSongsHandler(w http.ResponseWriter, r *http.Request)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	// Extract the sort query string value, falling back to "id" if it is not provided
-	// by the client (which will imply a ascending sort on movie ID).
-	input.Filters.Sort = app.readString(qs, "sort", "song_id")
-	// Add the supported sort values for this endpoint to the sort safelist.
-	// input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
-	input.Filters.SortSafelist = []string{"song_id", "title", "length", "-song_id", "-title", "-length"}
-
-	// Execute the validation checks on the Filters struct and send a response
-	// containing the errors if necessary.
+	// by the client (which will imply a ascending sort on song ID).
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	// An opaque cursor from a previous response switches to keyset pagination, in which
+	// case the page parameter is ignored.
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	// Add the supported sort values for this endpoint to the sort safelist. Several of
+	// them can be combined, separated by commas (e.g. "-length,title"), and the dotted
+	// ones sort on the song's album or group. Sort values are the camelCase field names
+	// used in the JSON responses and in filter expressions.
+	input.Filters.SortSafelist = []string{"id", "title", "length", "-id", "-title", "-length",
+		"album.title", "album.releaseDate", "album.group.name", "-album.title", "-album.releaseDate", "-album.group.name"}
+	// The filter expression, e.g. filter=length>=180 and album.genre="Pop", may only refer
+	// to the fields in the song filter safelist.
+	input.Filters.Filter = app.readString(qs, "filter", "")
+	input.Filters.FilterSafelist = data.SongFilterSafelist
+	// Facet counts are opt-in, e.g. facets=genre,length. They are computed over all the
+	// songs matching the filters above, not just the current page.
+	input.Facets = app.readCSV(qs, "facets", []string{})
+	// Only send the requested fields of each song, and embed related resources.
+	fs := app.readFieldset(qs, v, songFieldSafelist, songIncludeSafelist)
+
+	// Execute the validation checks on the Filters struct and the requested facets, and
+	// send a response containing the errors if necessary.
+	data.ValidateFacets(v, input.Facets)
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -270,8 +490,28 @@ func (app *application) listSongsHandler(w http.ResponseWriter, r *http.Request)
 	// Call the GetAll() method to retrieve the movies, passing in the various filter
 	// parameters.
 	// Accept the metadata struct as a return value.
-	// movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
-	songs, metadata, err := app.models.Songs.GetAll(input.Title, input.Length, input.Filters)
+	// movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.Title, input.Genres, input.Filters)
+	songs, metadata, err := app.models.Songs.GetAll(r.Context(), input.Title, input.Length, input.HasLength, input.Filters)
+	if err != nil {
+		switch {
+		// A cursor which decodes fine, but doesn't hold a value for every sort key,
+		// can only have been tampered with.
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", "must be a cursor returned by a previous request")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if len(input.Facets) > 0 {
+		metadata.Facets, err = app.models.Songs.GetFacets(r.Context(), input.Title, input.Length, input.HasLength, input.Filters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	shaped, err := app.shapeSongs(r.Context(), songs, fs)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -279,7 +519,7 @@ func (app *application) listSongsHandler(w http.ResponseWriter, r *http.Request)
 	// Send a JSON response containing the movie data.
 	// Include the metadata in the response envelope.
 	// err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
-	err = app.writeJSON(w, http.StatusOK, envelope{"songs": songs, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"songs": shaped, "metadata": metadata}, nil)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goproject/internal/jsonlog"
+)
+
+func TestRegisterUserHandlerRejectsLongPassword(t *testing.T) {
+	// Validation fails before the database is touched, so the application doesn't need
+	// any models.
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelOff)}
+
+	password := "Aa1!" + strings.Repeat("a", 69)
+	if len(password) != 73 {
+		t.Fatalf("password is %d bytes long", len(password))
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"name":     "Alice",
+		"email":    "alice@example.com",
+		"password": password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(string(body)))
+	app.registerUserHandler(rr, r)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d\n%s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+	}
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := response.Error["password"], "must not be more than 72 bytes long"; got != want {
+		t.Errorf("got password error %q; want %q", got, want)
+	}
+}
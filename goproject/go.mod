@@ -5,4 +5,6 @@ go 1.21.6
 require (
 	github.com/julienschmidt/httprouter v1.3.0 // direct
 	github.com/lib/pq v1.10.9 // direct
+	golang.org/x/crypto v0.21.0 // direct
+	golang.org/x/time v0.5.0 // direct
 )
@@ -0,0 +1,276 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"goproject/internal/validator"
+)
+
+type Album struct {
+	Id          int    `json:"id"`
+	Title       string `json:"title"`
+	Genre       string `json:"genre"`
+	NumOfTracks int    `json:"numOfTracks"`
+	GroupId     int    `json:"groupId"`
+	ReleaseDate Date   `json:"releaseDate"`
+}
+
+func ValidateAlbum(v *validator.Validator, album *Album) {
+	v.Check(album.Title != "", "title", "must be provided")
+	v.Check(len(album.Title) <= 25, "title", "must not be more than 25 bytes long")
+	v.Check(album.Genre != "", "genre", "must be provided")
+	v.Check(len(album.Genre) <= 25, "genre", "must not be more than 25 bytes long")
+	v.Check(album.NumOfTracks > 0, "numOfTracks", "must be greater than 0")
+	v.Check(album.GroupId > 0, "groupId", "must be greater than 0")
+	v.Check(!album.ReleaseDate.Time().After(time.Now()), "releaseDate", "must not be in the future")
+}
+
+// Define an AlbumModel struct type which wraps a sql.DB connection pool.
+type AlbumModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert a new record in the album table.
+func (a AlbumModel) Insert(ctx context.Context, album *Album) error {
+	query := `
+		INSERT INTO album(title, genre, num_of_tracks, group_id, release_date)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING album_id, title, genre, num_of_tracks, group_id, release_date;`
+
+	args := []interface{}{album.Title, album.Genre, album.NumOfTracks, album.GroupId, album.ReleaseDate}
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.Write)
+	defer cancel()
+
+	err := a.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&album.Id, &album.Title, &album.Genre, &album.NumOfTracks, &album.GroupId, &album.ReleaseDate)
+	return mapConstraintError(err)
+}
+
+// Fetch a specific record from the album table.
+func (a AlbumModel) Get(ctx context.Context, id int64) (*Album, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT album_id, title, genre, num_of_tracks, group_id, release_date
+		FROM album
+		WHERE album_id = $1;`
+
+	var album Album
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.Read)
+	defer cancel()
+
+	err := a.DB.QueryRowContext(ctx, annotate(ctx, query), id).Scan(&album.Id, &album.Title, &album.Genre, &album.NumOfTracks, &album.GroupId, &album.ReleaseDate)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &album, nil
+}
+
+// GetMany returns the albums with the given IDs, keyed by ID, in a single query. IDs
+// without a matching record are simply missing from the map.
+func (a AlbumModel) GetMany(ctx context.Context, ids []int64) (map[int]*Album, error) {
+	albums := map[int]*Album{}
+	if len(ids) == 0 {
+		return albums, nil
+	}
+
+	query := `
+		SELECT album_id, title, genre, num_of_tracks, group_id, release_date
+		FROM album
+		WHERE album_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.Read)
+	defer cancel()
+
+	rows, err := a.DB.QueryContext(ctx, annotate(ctx, query), pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var album Album
+		err := rows.Scan(&album.Id, &album.Title, &album.Genre, &album.NumOfTracks, &album.GroupId, &album.ReleaseDate)
+		if err != nil {
+			return nil, err
+		}
+		albums[album.Id] = &album
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+// Update a specific record in the album table.
+func (a AlbumModel) Update(ctx context.Context, album *Album) error {
+	query := `
+		UPDATE album
+		SET title = $1, genre = $2, num_of_tracks = $3, group_id = $4, release_date = $5
+		WHERE album_id = $6
+		RETURNING album_id, title, genre, num_of_tracks, group_id, release_date;`
+
+	args := []interface{}{album.Title, album.Genre, album.NumOfTracks, album.GroupId, album.ReleaseDate, album.Id}
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.Write)
+	defer cancel()
+
+	err := a.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&album.Id, &album.Title, &album.Genre, &album.NumOfTracks, &album.GroupId, &album.ReleaseDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return mapConstraintError(err)
+}
+
+// Delete a specific record from the album table.
+func (a AlbumModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM album
+		WHERE album_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.Write)
+	defer cancel()
+
+	result, err := a.DB.ExecContext(ctx, annotate(ctx, query), id)
+	if err != nil {
+		return mapDeleteError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of albums, optionally filtered by a full-text match on the
+// title, an exact genre, the owning group and a filter expression.
+func (a AlbumModel) GetAll(ctx context.Context, title string, genre string, groupId int, filters Filters) ([]*Album, Metadata, error) {
+	args := []interface{}{title, genre, groupId}
+
+	filter, err := filters.filterCondition(len(args) + 1)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	args = append(args, filter.args...)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), album.album_id, album.title, album.genre, album.num_of_tracks, album.group_id, album.release_date
+		FROM %s
+		WHERE (to_tsvector('simple', album.title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (LOWER(album.genre) = LOWER($2) OR $2 = '')
+		AND (album.group_id = $3 OR $3 = 0)
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, filters.fromClause("album", filter), filter.condition,
+		orderByClause(filters.sortKeys("album", "album_id"), false), len(args)+1, len(args)+2)
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.List)
+	defer cancel()
+
+	args = append(args, filters.limit(), filters.offset())
+
+	rows, err := a.DB.QueryContext(ctx, annotate(ctx, query), args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	albums := []*Album{}
+
+	for rows.Next() {
+		var album Album
+		err := rows.Scan(
+			&totalRecords,
+			&album.Id,
+			&album.Title,
+			&album.Genre,
+			&album.NumOfTracks,
+			&album.GroupId,
+			&album.ReleaseDate,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		albums = append(albums, &album)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return albums, metadata, nil
+}
+
+// GetSongs returns the tracklist of an album. Songs are ordered by their track number,
+// with songs that haven't been given a position yet listed last.
+func (a AlbumModel) GetSongs(ctx context.Context, id int64) ([]*Song, error) {
+	query := `
+		SELECT song_id, title, length, album_id, track_number, version
+		FROM song
+		WHERE album_id = $1
+		ORDER BY track_number NULLS LAST, song_id`
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.List)
+	defer cancel()
+
+	rows, err := a.DB.QueryContext(ctx, annotate(ctx, query), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songs := []*Song{}
+
+	for rows.Next() {
+		var song Song
+		err := rows.Scan(&song.Id, &song.Title, &song.Length, &song.Album_id, &song.TrackNumber, &song.Version)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, &song)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return songs, nil
+}
+
+// CountSongs returns the number of songs currently stored on an album, ignoring the
+// song with ID excludeSongId (pass 0 to count every song). This is used to check the
+// num_of_tracks column against reality when songs or albums are written.
+func (a AlbumModel) CountSongs(ctx context.Context, id int64, excludeSongId int) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM song
+		WHERE album_id = $1 AND song_id <> $2`
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeouts.Read)
+	defer cancel()
+
+	var count int
+	err := a.DB.QueryRowContext(ctx, annotate(ctx, query), id, excludeSongId).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"goproject/internal/validator"
+)
+
+// Every API key starts with this marker, which makes keys easy to spot (and to scan
+// for in leaked files). The characters after it up to the length of apiKeyPrefixLength
+// are stored in the clear, so that admins and logs can tell keys apart.
+const (
+	apiKeyMarker       = "gpk_"
+	apiKeyPrefixLength = len(apiKeyMarker) + 8
+)
+
+// ApiKey is a credential for service-to-service clients, such as ingestion jobs, which
+// shouldn't use a human account. Only the SHA-256 hash of the key is stored; the
+// plaintext is returned once, when the key is created or rotated.
+type ApiKey struct {
+	Id          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Plaintext   string      `json:"key,omitempty"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	Expiry      *time.Time  `json:"expiry"`
+	LastUsedAt  *time.Time  `json:"lastUsedAt"`
+	RevokedAt   *time.Time  `json:"revokedAt"`
+	hash        []byte
+}
+
+// User returns the principal an API key acts as. It is activated and not anonymous,
+// so that the key gets through the same middleware as a logged in user; what it may do
+// is limited by its own permissions.
+func (k *ApiKey) User() *User {
+	return &User{Name: "api key " + k.Prefix, Activated: true}
+}
+
+// generate fills in a new random plaintext key, along with its prefix and hash.
+func (k *ApiKey) generate() error {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	k.Plaintext = apiKeyMarker + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	k.Prefix = k.Plaintext[:apiKeyPrefixLength]
+	hash := sha256.Sum256([]byte(k.Plaintext))
+	k.hash = hash[:]
+	return nil
+}
+
+func ValidateApiKey(v *validator.Validator, key *ApiKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Permissions) > 0, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		v.Check(validator.In(code, CatalogPermissions...), "permissions", "must only contain catalog permissions")
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// Check that a plaintext API key sent by a client looks like one of ours.
+func ValidateApiKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(strings.HasPrefix(keyPlaintext, apiKeyMarker), "key", "must be an API key")
+	v.Check(len(keyPlaintext) == len(apiKeyMarker)+32, "key", "must be an API key")
+}
+
+// Define the ApiKeyModel type.
+type ApiKeyModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert generates a new key and stores it. The plaintext is left in key.Plaintext for
+// the caller to hand out.
+func (m ApiKeyModel) Insert(ctx context.Context, key *ApiKey) error {
+	err := key.generate()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO api_key (name, prefix, hash, permissions, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING api_key_id, created_at`
+
+	args := []interface{}{key.Name, key.Prefix, key.hash, pq.Array([]string(key.Permissions)), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&key.Id, &key.CreatedAt)
+}
+
+// GetAll returns every API key, including revoked ones, newest first.
+func (m ApiKeyModel) GetAll(ctx context.Context) ([]*ApiKey, error) {
+	query := `
+		SELECT api_key_id, name, prefix, permissions, created_at, expiry, last_used_at, revoked_at
+		FROM api_key
+		ORDER BY api_key_id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, annotate(ctx, query))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*ApiKey{}
+
+	for rows.Next() {
+		var key ApiKey
+		err := rows.Scan(&key.Id, &key.Name, &key.Prefix, pq.Array((*[]string)(&key.Permissions)), &key.CreatedAt, &key.Expiry, &key.LastUsedAt, &key.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Rotate replaces the secret of an active key with a new one, keeping its name,
+// permissions and expiry. The old plaintext stops working immediately.
+func (m ApiKeyModel) Rotate(ctx context.Context, id int64) (*ApiKey, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var key ApiKey
+	err := key.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE api_key
+		SET prefix = $1, hash = $2
+		WHERE api_key_id = $3 AND revoked_at IS NULL
+		RETURNING api_key_id, name, permissions, created_at, expiry, last_used_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, annotate(ctx, query), key.Prefix, key.hash, id).Scan(&key.Id, &key.Name, pq.Array((*[]string)(&key.Permissions)), &key.CreatedAt, &key.Expiry, &key.LastUsedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// Revoke marks a key as revoked. The record is kept, so that it still shows up in the
+// listing along with when it was last used.
+func (m ApiKeyModel) Revoke(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE api_key
+		SET revoked_at = NOW()
+		WHERE api_key_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, annotate(ctx, query), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForPlaintext looks up an active key (neither revoked nor expired) by its
+// plaintext, and records that it was used.
+func (m ApiKeyModel) GetForPlaintext(ctx context.Context, keyPlaintext string) (*ApiKey, error) {
+	hash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+		UPDATE api_key
+		SET last_used_at = NOW()
+		WHERE hash = $1
+		AND revoked_at IS NULL
+		AND (expiry IS NULL OR expiry > NOW())
+		RETURNING api_key_id, name, prefix, permissions, created_at, expiry, last_used_at`
+
+	var key ApiKey
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, annotate(ctx, query), hash[:]).Scan(&key.Id, &key.Name, &key.Prefix, pq.Array((*[]string)(&key.Permissions)), &key.CreatedAt, &key.Expiry, &key.LastUsedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// PostgreSQL error codes for the integrity constraint violations we translate. See
+// https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	pqNotNullViolation    = pq.ErrorCode("23502")
+	pqForeignKeyViolation = pq.ErrorCode("23503")
+	pqUniqueViolation     = pq.ErrorCode("23505")
+	pqCheckViolation      = pq.ErrorCode("23514")
+)
+
+// Errors returned (wrapped in a *ConstraintError) when a write is rejected by one of the
+// database constraints, so that handlers can tell them apart from unexpected failures.
+var (
+	ErrDuplicateID      = errors.New("duplicate id")
+	ErrDuplicateValue   = errors.New("duplicate value")
+	ErrInvalidReference = errors.New("invalid reference")
+	ErrMissingValue     = errors.New("missing value")
+	ErrCheckViolation   = errors.New("check constraint violation")
+
+	// ErrRecordInUse is returned when a record can't be deleted because other records
+	// still reference it through a foreign key.
+	ErrRecordInUse = errors.New("record is still referenced by other records")
+)
+
+// ConstraintError describes a rejected write. Err is one of the sentinel errors above
+// and Field is the JSON name of the field the violated constraint relates to.
+type ConstraintError struct {
+	Err        error
+	Field      string
+	Constraint string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s (field %q, constraint %q)", e.Err, e.Field, e.Constraint)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Constraints whose field can't be derived from the default PostgreSQL constraint name.
+var constraintFields = map[string]string{
+	"song_album_track_number_key": "trackNumber",
+}
+
+// The tables with a primary key that doesn't follow the <table>_id naming scheme.
+var primaryKeyColumns = map[string]string{
+	"groups": "group_id",
+	"users":  "user_id",
+}
+
+// mapConstraintError inspects an error returned by the database and, if it is a
+// constraint violation we know how to report, converts it into a *ConstraintError.
+// Any other error is returned unchanged.
+func mapConstraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		if strings.HasSuffix(pqErr.Constraint, "_pkey") {
+			return &ConstraintError{Err: ErrDuplicateID, Field: "id", Constraint: pqErr.Constraint}
+		}
+		return &ConstraintError{Err: ErrDuplicateValue, Field: constraintField(pqErr), Constraint: pqErr.Constraint}
+	case pqForeignKeyViolation:
+		return &ConstraintError{Err: ErrInvalidReference, Field: constraintField(pqErr), Constraint: pqErr.Constraint}
+	case pqNotNullViolation:
+		return &ConstraintError{Err: ErrMissingValue, Field: columnField(pqErr.Table, pqErr.Column), Constraint: pqErr.Constraint}
+	case pqCheckViolation:
+		return &ConstraintError{Err: ErrCheckViolation, Field: constraintField(pqErr), Constraint: pqErr.Constraint}
+	}
+	return err
+}
+
+// mapDeleteError is used by the Delete() methods. A foreign key violation there means
+// the record is still referenced, which we report as ErrRecordInUse.
+func mapDeleteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqForeignKeyViolation {
+		return ErrRecordInUse
+	}
+	return err
+}
+
+// constraintField derives the JSON field name from a default PostgreSQL constraint
+// name such as "song_album_id_fkey" or "song_track_number_check".
+func constraintField(pqErr *pq.Error) string {
+	if field, ok := constraintFields[pqErr.Constraint]; ok {
+		return field
+	}
+
+	column := strings.TrimPrefix(pqErr.Constraint, pqErr.Table+"_")
+	for _, suffix := range []string{"_fkey", "_check", "_key"} {
+		column = strings.TrimSuffix(column, suffix)
+	}
+	return columnField(pqErr.Table, column)
+}
+
+// columnField converts a column name into the name used for it in JSON, for example
+// "album_id" becomes "albumId" and the primary key column of any table becomes "id".
+func columnField(table, column string) string {
+	primaryKey, ok := primaryKeyColumns[table]
+	if !ok {
+		primaryKey = table + "_id"
+	}
+	if column == primaryKey {
+		return "id"
+	}
+
+	parts := strings.Split(column, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the decoded form of the opaque "cursor" query string parameter used for
+// keyset pagination. It records the sort the cursor was created for and the values of
+// every sort key (ending with the ID tiebreaker) of the row it points at, in their
+// PostgreSQL text form. A nil value stands for NULL. Prev is set on cursors that page
+// backwards from that row.
+type cursor struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v"`
+	Prev   bool      `json:"p,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(js, &c)
+	if err != nil || len(c.Values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// sortKey is one expression of an ORDER BY clause.
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+func (k sortKey) String() string {
+	if k.desc {
+		return k.expr + " DESC"
+	}
+	return k.expr + " ASC"
+}
+
+// orderByClause joins the sort keys into the body of an ORDER BY clause. If reverse is
+// true every direction is flipped, which is how we walk backwards from a cursor.
+func orderByClause(keys []sortKey, reverse bool) string {
+	clauses := make([]string, len(keys))
+	for i, key := range keys {
+		if reverse {
+			key.desc = !key.desc
+		}
+		clauses[i] = key.String()
+	}
+	return strings.Join(clauses, ", ")
+}
+
+// keysetCondition builds a WHERE condition matching the rows which come strictly after
+// the given values in the ordering described by keys. Placeholders are numbered from
+// firstArg and the matching arguments are returned.
+//
+// The condition is the expanded form of a row comparison, (k1 > v1) OR (k1 = v1 AND
+// k2 > v2) OR ..., so that every key can have its own direction. It also follows the
+// PostgreSQL default of sorting NULLs last in ascending and first in descending order,
+// so nullable columns page correctly.
+func keysetCondition(keys []sortKey, values []*string, reverse bool, firstArg int) (string, []interface{}, error) {
+	if len(values) != len(keys) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	args := []interface{}{}
+	placeholder := func(value string) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", firstArg+len(args)-1)
+	}
+
+	var alternatives []string
+	var equalities []string
+
+	for i, key := range keys {
+		desc := key.desc != reverse
+		value := values[i]
+
+		var after string
+		switch {
+		case value == nil && !desc:
+			after = "FALSE"
+		case value == nil && desc:
+			after = fmt.Sprintf("%s IS NOT NULL", key.expr)
+		case !desc:
+			after = fmt.Sprintf("(%s > %s OR %s IS NULL)", key.expr, placeholder(*value), key.expr)
+		default:
+			after = fmt.Sprintf("%s < %s", key.expr, placeholder(*value))
+		}
+
+		alternatives = append(alternatives, "("+strings.Join(append(equalities[:len(equalities):len(equalities)], after), " AND ")+")")
+
+		if i == len(keys)-1 {
+			break
+		}
+		if value == nil {
+			equalities = append(equalities, fmt.Sprintf("%s IS NULL", key.expr))
+		} else {
+			equalities = append(equalities, fmt.Sprintf("%s = %s", key.expr, placeholder(*value)))
+		}
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args, nil
+}
+
+// sortValueColumns returns the select list entries holding the text form of each sort
+// key, from which cursors are built.
+func sortValueColumns(keys []sortKey) string {
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		columns[i] = fmt.Sprintf("(%s)::text", key.expr)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// pageCursors builds the cursors pointing after the last row and before the first row
+// of a page, given the sort key values of each row on it. Empty strings are returned
+// when there is no page in that direction.
+func pageCursors(sort string, positions [][]*string, hasNext, hasPrev bool) (next, prev string) {
+	if len(positions) == 0 {
+		return "", ""
+	}
+	if hasNext {
+		next = encodeCursor(cursor{Sort: sort, Values: positions[len(positions)-1]})
+	}
+	if hasPrev {
+		prev = encodeCursor(cursor{Sort: sort, Values: positions[0], Prev: true})
+	}
+	return next, prev
+}
+
+func nullStringPointers(values []sql.NullString) []*string {
+	pointers := make([]*string, len(values))
+	for i, value := range values {
+		if value.Valid {
+			s := value.String
+			pointers[i] = &s
+		}
+	}
+	return pointers
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestDecodeCursor(t *testing.T) {
+	// A cursor survives a round trip, including NULL values and the Prev flag.
+	c := cursor{Sort: "-length,title", Values: []*string{nil, strPtr("Bohemian Rhapsody")}, Prev: true}
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*got, c) {
+		t.Errorf("got %+v; want %+v", *got, c)
+	}
+
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	for _, s := range []string{"", "not base64!", encode("not json"), encode(`{"s":"title","v":[]}`)} {
+		if _, err := decodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q): got %v; want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	title := sortKey{expr: "song.title"}
+	id := sortKey{expr: "song.song_id"}
+	length := sortKey{expr: "song.length", desc: true}
+
+	tests := []struct {
+		name      string
+		keys      []sortKey
+		values    []*string
+		reverse   bool
+		firstArg  int
+		condition string
+		args      []interface{}
+	}{
+		{
+			name:      "Tie broken by the next key",
+			keys:      []sortKey{title, id},
+			values:    []*string{strPtr("a"), strPtr("5")},
+			firstArg:  3,
+			condition: "(((song.title > $3 OR song.title IS NULL)) OR (song.title = $4 AND (song.song_id > $5 OR song.song_id IS NULL)))",
+			args:      []interface{}{"a", "a", "5"},
+		},
+		{
+			name:      "Descending",
+			keys:      []sortKey{length, id},
+			values:    []*string{strPtr("180"), strPtr("5")},
+			firstArg:  1,
+			condition: "((song.length < $1) OR (song.length = $2 AND (song.song_id > $3 OR song.song_id IS NULL)))",
+			args:      []interface{}{"180", "180", "5"},
+		},
+		{
+			name:      "Reversed",
+			keys:      []sortKey{title, id},
+			values:    []*string{strPtr("a"), strPtr("5")},
+			reverse:   true,
+			firstArg:  1,
+			condition: "((song.title < $1) OR (song.title = $2 AND song.song_id < $3))",
+			args:      []interface{}{"a", "a", "5"},
+		},
+		{
+			// NULLs sort last in ascending order, so nothing comes after them but
+			// other NULLs with a greater tiebreaker.
+			name:      "NULL in ascending order",
+			keys:      []sortKey{title, id},
+			values:    []*string{nil, strPtr("5")},
+			firstArg:  1,
+			condition: "((FALSE) OR (song.title IS NULL AND (song.song_id > $1 OR song.song_id IS NULL)))",
+			args:      []interface{}{"5"},
+		},
+		{
+			// NULLs sort first in descending order, so every non-NULL value comes
+			// after them.
+			name:      "NULL in descending order",
+			keys:      []sortKey{length, id},
+			values:    []*string{nil, strPtr("5")},
+			firstArg:  1,
+			condition: "((song.length IS NOT NULL) OR (song.length IS NULL AND (song.song_id > $1 OR song.song_id IS NULL)))",
+			args:      []interface{}{"5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args, err := keysetCondition(tt.keys, tt.values, tt.reverse, tt.firstArg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if condition != tt.condition {
+				t.Errorf("got condition %q; want %q", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got args %v; want %v", args, tt.args)
+			}
+		})
+	}
+
+	// A cursor with the wrong number of values doesn't belong to this sort.
+	_, _, err := keysetCondition([]sortKey{title, id}, []*string{strPtr("5")}, false, 1)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got %v; want ErrInvalidCursor", err)
+	}
+}
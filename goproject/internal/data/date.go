@@ -0,0 +1,99 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The layout used for every DATE column we expose through the API, for example
+// "2013-06-13".
+const dateLayout = "2006-01-02"
+
+// Define an error that our UnmarshalJSON() method can return if we're unable to parse
+// or convert the JSON string successfully.
+var ErrInvalidDateFormat = errors.New("invalid date format, expected YYYY-MM-DD")
+
+// Declare a custom Date type, which has the underlying type time.Time. It is used for
+// the groups.launch_date and singer.birthday columns so that they are encoded as plain
+// "YYYY-MM-DD" strings instead of full RFC3339 timestamps. A zero Date maps to NULL in
+// the database and to null in JSON.
+type Date time.Time
+
+// Time returns the underlying time.Time value.
+func (d Date) Time() time.Time {
+	return time.Time(d)
+}
+
+// IsZero reports whether the date has not been set.
+func (d Date) IsZero() bool {
+	return time.Time(d).IsZero()
+}
+
+// Implement a MarshalJSON() method on the Date type so that it satisfies the
+// json.Marshaler interface.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Quote(time.Time(d).Format(dateLayout))), nil
+}
+
+// Implement a UnmarshalJSON() method on the Date type so that it satisfies the
+// json.Unmarshaler interface. IMPORTANT: Because UnmarshalJSON() needs to modify the
+// receiver (our Date type), we must use a pointer receiver for this to work correctly.
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	if string(jsonValue) == "null" {
+		*d = Date{}
+		return nil
+	}
+
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	t, err := time.Parse(dateLayout, unquotedJSONValue)
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	*d = Date(t)
+	return nil
+}
+
+// Scan implements the sql.Scanner interface so that DATE columns (which may be NULL)
+// can be read straight into a Date.
+func (d *Date) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = Date(time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC))
+	case []byte:
+		t, err := time.Parse(dateLayout, string(v))
+		if err != nil {
+			return err
+		}
+		*d = Date(t)
+	case string:
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return err
+		}
+		*d = Date(t)
+	default:
+		return fmt.Errorf("cannot scan %T into Date", value)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface. A zero Date is stored as NULL.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return time.Time(d).Format(dateLayout), nil
+}
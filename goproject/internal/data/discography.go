@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Discography is a group together with every album it has released and the songs on
+// each album, as returned by "GET /v1/groups/:id/discography".
+type Discography struct {
+	Group  *Group              `json:"group"`
+	Albums []*DiscographyAlbum `json:"albums"`
+}
+
+// DiscographyAlbum embeds an Album so its fields are encoded inline, next to the
+// album's tracklist.
+type DiscographyAlbum struct {
+	Album
+	Songs []*Song `json:"songs"`
+}
+
+// GetDiscography builds the discography of a group using a fixed number of queries,
+// no matter how many albums the group has: one for the group, one for its albums and
+// one for the songs of all of those albums. The queries run in a read-only REPEATABLE
+// READ transaction so that they all see the same snapshot of the data.
+func (g GroupModel) GetDiscography(ctx context.Context, id int64) (*Discography, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.List)
+	defer cancel()
+
+	tx, err := g.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var group Group
+
+	query := `
+		SELECT group_id, name, num_of_members, launch_date
+		FROM groups
+		WHERE group_id = $1;`
+
+	err = tx.QueryRowContext(ctx, annotate(ctx, query), id).Scan(&group.Id, &group.Name, &group.NumOfMembers, &group.LaunchDate)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// Albums are listed in release order. Albums without a release date go last, and
+	// album_id breaks any ties.
+	query = `
+		SELECT album_id, title, genre, num_of_tracks, group_id, release_date
+		FROM album
+		WHERE group_id = $1
+		ORDER BY release_date NULLS LAST, album_id`
+
+	rows, err := tx.QueryContext(ctx, annotate(ctx, query), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	albums := []*DiscographyAlbum{}
+	albumsById := make(map[int]*DiscographyAlbum)
+	albumIds := []int64{}
+
+	for rows.Next() {
+		album := &DiscographyAlbum{Songs: []*Song{}}
+		err := rows.Scan(&album.Id, &album.Title, &album.Genre, &album.NumOfTracks, &album.GroupId, &album.ReleaseDate)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+		albumsById[album.Id] = album
+		albumIds = append(albumIds, int64(album.Id))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(albumIds) > 0 {
+		query = `
+			SELECT song_id, title, length, album_id, track_number, version
+			FROM song
+			WHERE album_id = ANY($1)
+			ORDER BY album_id, track_number NULLS LAST, song_id`
+
+		songRows, err := tx.QueryContext(ctx, annotate(ctx, query), pq.Array(albumIds))
+		if err != nil {
+			return nil, err
+		}
+		defer songRows.Close()
+
+		for songRows.Next() {
+			var song Song
+			err := songRows.Scan(&song.Id, &song.Title, &song.Length, &song.Album_id, &song.TrackNumber, &song.Version)
+			if err != nil {
+				return nil, err
+			}
+			album := albumsById[song.Album_id]
+			album.Songs = append(album.Songs, &song)
+		}
+		if err = songRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Discography{Group: &group, Albums: albums}, nil
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"goproject/internal/validator"
+)
+
+// The maximum number of values returned for a single facet. Values are ranked by the
+// number of matching songs, so the least common ones are dropped first.
+const maxFacetValues = 50
+
+// SongFacets lists the facets that can be requested on the song listing.
+var SongFacets = []string{"genre", "group", "album", "length"}
+
+// The upper bounds, in seconds, of the song length buckets. Songs at or above the last
+// bound fall into a final open-ended bucket.
+var lengthBuckets = []int{120, 180, 240, 300}
+
+// FacetCount is the number of songs in the listing sharing one value of a facet. Id is
+// set for facets over related resources (groups and albums), and Value is nil for
+// songs without a value, such as songs with an unknown length.
+type FacetCount struct {
+	Id    *int    `json:"id,omitempty"`
+	Value *string `json:"value"`
+	Count int     `json:"count"`
+}
+
+// songFacet describes how a facet is computed from the matching songs: the expressions
+// for its id and value, and the order its values are ranked in.
+type songFacet struct {
+	id    string
+	value string
+	order string
+}
+
+var songFacetQueries = map[string]songFacet{
+	"genre":  {id: "NULL::integer", value: "genre", order: "count(*) DESC, genre"},
+	"group":  {id: "group_id", value: "group_name", order: "count(*) DESC, group_name, group_id"},
+	"album":  {id: "album_id", value: "album_title", order: "count(*) DESC, album_title, album_id"},
+	"length": {id: "NULL::integer", value: lengthBucketExpr(), order: "min(length) NULLS LAST"},
+}
+
+// lengthBucketExpr returns a SQL expression labelling each song length with its bucket,
+// e.g. "120-179" or "300+". Songs with an unknown length get NULL.
+func lengthBucketExpr() string {
+	var b strings.Builder
+	b.WriteString("CASE WHEN length IS NULL THEN NULL")
+	lower := 0
+	for _, upper := range lengthBuckets {
+		fmt.Fprintf(&b, " WHEN length < %d THEN '%d-%d'", upper, lower, upper-1)
+		lower = upper
+	}
+	fmt.Fprintf(&b, " ELSE '%d+' END", lower)
+	return b.String()
+}
+
+func ValidateFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Check(validator.In(facet, SongFacets...), "facets", "invalid facet")
+	}
+	v.Check(validator.Unique(facets), "facets", "must not contain duplicate values")
+}
+
+// GetFacets returns the counts for the requested facets over all the songs matching
+// the listing parameters, ignoring pagination. The parameters are the same as for
+// GetAll(), so the counts always agree with the active filters. All facets are
+// computed in a single query.
+func (s SongModel) GetFacets(ctx context.Context, title string, length int, hasLength *bool, filters Filters, facets []string) (map[string][]FacetCount, error) {
+	result := map[string][]FacetCount{}
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	where, args, filter, err := songConditions(title, length, hasLength, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	// The facets need the album and its group, on top of any joins of the filter.
+	filter.joins = append(filter.joins, "album", "album.group")
+
+	branches := make([]string, len(facets))
+	for i, name := range facets {
+		facet := songFacetQueries[name]
+		branches[i] = fmt.Sprintf(`SELECT '%s' AS facet, %s AS id, %s AS value, count(*) AS count,
+				row_number() OVER (ORDER BY %s) AS rank
+			FROM matches
+			GROUP BY 2, 3`, name, facet.id, facet.value, facet.order)
+		result[name] = []FacetCount{}
+	}
+
+	query := fmt.Sprintf(`
+		WITH matches AS (
+			SELECT song.song_id, song.length, song.album_id, album.title AS album_title, album.genre,
+				album.group_id, groups.name AS group_name
+			FROM %s
+			WHERE %s
+		)
+		SELECT facet, id, value, count
+		FROM (
+			%s
+		) facets
+		WHERE rank <= %d
+		ORDER BY facet, rank`, filters.fromClause("song", filter), where,
+		strings.Join(branches, "\n\t\t\tUNION ALL\n\t\t\t"), maxFacetValues)
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.List)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, annotate(ctx, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var count FacetCount
+		err := rows.Scan(&name, &count.Id, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = append(result[name], count)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,574 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// This file implements the small expression language accepted by the "filter" query
+// string parameter of the list endpoints, for example:
+//
+//	length>=180 and album.genre="Pop"
+//	(title~"love" or album.group.name in ("BTS", "EXO")) and length is not null
+//	album.releaseDate between "2018-01-01" and "2020-12-31"
+//
+// Grammar (keywords are case-insensitive):
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = field ( op value
+//	                   | ["not"] "in" "(" value { "," value } ")"
+//	                   | ["not"] "between" value "and" value
+//	                   | "is" ["not"] "null" )
+//	op         = "=" | "!=" | "<>" | "<" | "<=" | ">" | ">=" | "~"
+//	value      = string | number | "true" | "false"
+//
+// "~" is a case-insensitive substring match on string fields. Fields must be listed in
+// the resource's FilterSafelist, exactly like sort values must be listed in the
+// SortSafelist, and values are always passed to the database as placeholders.
+
+// Limits which stop a client from sending a pathologically large expression.
+const (
+	maxFilterLength      = 1000
+	maxFilterComparisons = 50
+	maxFilterDepth       = 20
+)
+
+var ErrInvalidFilter = errors.New("invalid filter expression")
+
+// The comparison operators of the grammar, mapped to their SQL form. "~" is compiled
+// separately, but is listed here so that the lexer accepts it.
+var filterOperators = map[string]string{
+	"=":  "=",
+	"!=": "<>",
+	"<>": "<>",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+	"~":  "ILIKE",
+}
+
+// FieldType is the type of a filterable field. It decides which literals a field can
+// be compared with and which operators are allowed.
+type FieldType int
+
+const (
+	StringField FieldType = iota
+	IntField
+	DateField
+	BoolField
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case IntField:
+		return "an integer"
+	case DateField:
+		return "a date in YYYY-MM-DD format"
+	case BoolField:
+		return "true or false"
+	default:
+		return "a string"
+	}
+}
+
+// FilterField maps the name of a field in a filter expression to a SQL expression.
+// Joins lists, in order, the joins from the FilterSafelist the expression needs.
+type FilterField struct {
+	Column string
+	Type   FieldType
+	Joins  []string
+}
+
+// FilterJoin is a join that a FilterField can depend on.
+type FilterJoin struct {
+	Name   string
+	Clause string
+}
+
+// FilterSafelist describes everything a filter expression may refer to for one
+// resource. Joins are listed in the order they must appear in the FROM clause.
+type FilterSafelist struct {
+	Fields map[string]FilterField
+	Joins  []FilterJoin
+}
+
+// The filter safelists for each resource. Related resources are reached through
+// dotted names, which are turned into LEFT JOINs only when an expression uses them.
+var (
+	SongFilterSafelist = FilterSafelist{
+		Fields: map[string]FilterField{
+			"id":                     {Column: "song.song_id", Type: IntField},
+			"title":                  {Column: "song.title", Type: StringField},
+			"length":                 {Column: "song.length", Type: IntField},
+			"albumId":                {Column: "song.album_id", Type: IntField},
+			"trackNumber":            {Column: "song.track_number", Type: IntField},
+			"album.title":            {Column: "album.title", Type: StringField, Joins: []string{"album"}},
+			"album.genre":            {Column: "album.genre", Type: StringField, Joins: []string{"album"}},
+			"album.numOfTracks":      {Column: "album.num_of_tracks", Type: IntField, Joins: []string{"album"}},
+			"album.releaseDate":      {Column: "album.release_date", Type: DateField, Joins: []string{"album"}},
+			"album.groupId":          {Column: "album.group_id", Type: IntField, Joins: []string{"album"}},
+			"album.group.name":       {Column: "groups.name", Type: StringField, Joins: []string{"album", "album.group"}},
+			"album.group.launchDate": {Column: "groups.launch_date", Type: DateField, Joins: []string{"album", "album.group"}},
+		},
+		Joins: []FilterJoin{
+			{Name: "album", Clause: "LEFT JOIN album ON album.album_id = song.album_id"},
+			{Name: "album.group", Clause: "LEFT JOIN groups ON groups.group_id = album.group_id"},
+		},
+	}
+
+	AlbumFilterSafelist = FilterSafelist{
+		Fields: map[string]FilterField{
+			"id":               {Column: "album.album_id", Type: IntField},
+			"title":            {Column: "album.title", Type: StringField},
+			"genre":            {Column: "album.genre", Type: StringField},
+			"numOfTracks":      {Column: "album.num_of_tracks", Type: IntField},
+			"releaseDate":      {Column: "album.release_date", Type: DateField},
+			"groupId":          {Column: "album.group_id", Type: IntField},
+			"group.name":       {Column: "groups.name", Type: StringField, Joins: []string{"group"}},
+			"group.launchDate": {Column: "groups.launch_date", Type: DateField, Joins: []string{"group"}},
+		},
+		Joins: []FilterJoin{
+			{Name: "group", Clause: "LEFT JOIN groups ON groups.group_id = album.group_id"},
+		},
+	}
+
+	GroupFilterSafelist = FilterSafelist{
+		Fields: map[string]FilterField{
+			"id":           {Column: "groups.group_id", Type: IntField},
+			"name":         {Column: "groups.name", Type: StringField},
+			"numOfMembers": {Column: "groups.num_of_members", Type: IntField},
+			"launchDate":   {Column: "groups.launch_date", Type: DateField},
+		},
+	}
+
+	SingerFilterSafelist = FilterSafelist{
+		Fields: map[string]FilterField{
+			"id":         {Column: "singer.singer_id", Type: IntField},
+			"firstName":  {Column: "singer.first_name", Type: StringField},
+			"lastName":   {Column: "singer.last_name", Type: StringField},
+			"birthday":   {Column: "singer.birthday", Type: DateField},
+			"groupId":    {Column: "singer.group_id", Type: IntField},
+			"group.name": {Column: "groups.name", Type: StringField, Joins: []string{"group"}},
+		},
+		Joins: []FilterJoin{
+			{Name: "group", Clause: "LEFT JOIN groups ON groups.group_id = singer.group_id"},
+		},
+	}
+)
+
+// compiledFilter is the SQL form of a filter expression. Joins holds the names of the
+// FilterSafelist joins the condition needs.
+type compiledFilter struct {
+	condition string
+	args      []interface{}
+	joins     []string
+}
+
+// compileFilter parses a filter expression and checks it against the safelist. The
+// resulting condition numbers its placeholders from firstArg. An empty expression
+// compiles to TRUE.
+func compileFilter(expression string, safelist FilterSafelist, firstArg int) (*compiledFilter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return &compiledFilter{condition: "TRUE"}, nil
+	}
+	if len(expression) > maxFilterLength {
+		return nil, fmt.Errorf("%w: must not be more than %d bytes long", ErrInvalidFilter, maxFilterLength)
+	}
+
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{
+		tokens:   tokens,
+		safelist: safelist,
+		firstArg: firstArg,
+		used:     map[string]bool{},
+	}
+
+	condition, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.unexpected(tok)
+	}
+
+	var joins []string
+	for _, join := range safelist.Joins {
+		if p.used[join.Name] {
+			joins = append(joins, join.Name)
+		}
+	}
+
+	return &compiledFilter{condition: condition, args: p.args, joins: joins}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	value string
+}
+
+// keyword reports whether the token is the given (case-insensitive) keyword.
+func (t token) keyword(word string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, word)
+}
+
+func lexFilter(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: start})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: start})
+			i++
+
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: start})
+			i++
+
+		case r == '"' || r == '\'':
+			quote := r
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidFilter, start+1)
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == quote {
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start:i]), pos: start, value: sb.String()})
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start, value: string(runes[start:i])})
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+
+		case strings.ContainsRune("=!<>~", r):
+			i++
+			if i < len(runes) && (runes[i] == '=' || (r == '<' && runes[i] == '>')) {
+				i++
+			}
+			// Any other run of operator characters, such as "==" or "~=", is an error
+			// rather than something to pass through to the database.
+			op := string(runes[start:i])
+			if _, ok := filterOperators[op]; !ok {
+				return nil, fmt.Errorf("%w: unknown operator %q at position %d", ErrInvalidFilter, op, start+1)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: start})
+
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidFilter, string(r), start+1)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type filterParser struct {
+	tokens      []token
+	pos         int
+	safelist    FilterSafelist
+	firstArg    int
+	args        []interface{}
+	used        map[string]bool
+	comparisons int
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) unexpected(tok token) error {
+	if tok.kind == tokenEOF {
+		return fmt.Errorf("%w: unexpected end of expression", ErrInvalidFilter)
+	}
+	return fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidFilter, tok.text, tok.pos+1)
+}
+
+func (p *filterParser) expectKeyword(word string) error {
+	if tok := p.next(); !tok.keyword(word) {
+		return p.unexpected(tok)
+	}
+	return nil
+}
+
+func (p *filterParser) placeholder(value interface{}) string {
+	p.args = append(p.args, value)
+	return fmt.Sprintf("$%d", p.firstArg+len(p.args)-1)
+}
+
+func (p *filterParser) parseOr(depth int) (string, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return "", err
+	}
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s OR %s)", left, right)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (string, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return "", err
+	}
+	for p.peek().keyword("and") {
+		p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s AND %s)", left, right)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (string, error) {
+	if depth > maxFilterDepth {
+		return "", fmt.Errorf("%w: must not be nested more than %d levels deep", ErrInvalidFilter, maxFilterDepth)
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.keyword("not"):
+		p.next()
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT %s)", operand), nil
+
+	case tok.kind == tokenLParen:
+		p.next()
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return "", p.unexpected(closing)
+		}
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	p.comparisons++
+	if p.comparisons > maxFilterComparisons {
+		return "", fmt.Errorf("%w: must not contain more than %d comparisons", ErrInvalidFilter, maxFilterComparisons)
+	}
+
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return "", p.unexpected(tok)
+	}
+	field, ok := p.safelist.Fields[tok.text]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, tok.text)
+	}
+	for _, join := range field.Joins {
+		p.used[join] = true
+	}
+	column := field.Column
+
+	tok = p.next()
+	switch {
+	case tok.kind == tokenOperator:
+		if tok.text == "~" {
+			if field.Type != StringField {
+				return "", fmt.Errorf("%w: operator \"~\" can only be used with string fields", ErrInvalidFilter)
+			}
+			value, err := p.parseValue(tok.text, field)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s ILIKE '%%' || %s::text || '%%'", column, p.placeholder(escapeLike(value.(string)))), nil
+		}
+		if field.Type == BoolField && tok.text != "=" && tok.text != "!=" && tok.text != "<>" {
+			return "", fmt.Errorf("%w: operator %q can't be used with boolean fields", ErrInvalidFilter, tok.text)
+		}
+		op, ok := filterOperators[tok.text]
+		if !ok {
+			return "", fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, tok.text)
+		}
+		value, err := p.parseValue(tok.text, field)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", column, op, p.placeholder(value)), nil
+
+	case tok.keyword("is"):
+		negate := false
+		if p.peek().keyword("not") {
+			p.next()
+			negate = true
+		}
+		if err := p.expectKeyword("null"); err != nil {
+			return "", err
+		}
+		if negate {
+			return fmt.Sprintf("%s IS NOT NULL", column), nil
+		}
+		return fmt.Sprintf("%s IS NULL", column), nil
+
+	case tok.keyword("not") || tok.keyword("in") || tok.keyword("between"):
+		negate := ""
+		if tok.keyword("not") {
+			negate = "NOT "
+			tok = p.next()
+		}
+
+		switch {
+		case tok.keyword("in"):
+			if open := p.next(); open.kind != tokenLParen {
+				return "", p.unexpected(open)
+			}
+			var placeholders []string
+			for {
+				value, err := p.parseValue("in", field)
+				if err != nil {
+					return "", err
+				}
+				placeholders = append(placeholders, p.placeholder(value))
+
+				sep := p.next()
+				if sep.kind == tokenRParen {
+					break
+				}
+				if sep.kind != tokenComma {
+					return "", p.unexpected(sep)
+				}
+			}
+			return fmt.Sprintf("%s %sIN (%s)", column, negate, strings.Join(placeholders, ", ")), nil
+
+		case tok.keyword("between"):
+			low, err := p.parseValue("between", field)
+			if err != nil {
+				return "", err
+			}
+			if err := p.expectKeyword("and"); err != nil {
+				return "", err
+			}
+			high, err := p.parseValue("between", field)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s %sBETWEEN %s AND %s", column, negate, p.placeholder(low), p.placeholder(high)), nil
+		}
+	}
+
+	return "", p.unexpected(tok)
+}
+
+// parseValue reads a literal and converts it to the Go value for the field's type.
+func (p *filterParser) parseValue(op string, field FilterField) (interface{}, error) {
+	tok := p.next()
+
+	switch field.Type {
+	case StringField:
+		if tok.kind == tokenString {
+			return tok.value, nil
+		}
+	case IntField:
+		if tok.kind == tokenNumber {
+			n, err := strconv.ParseInt(tok.value, 10, 32)
+			if err == nil {
+				return n, nil
+			}
+		}
+	case DateField:
+		if tok.kind == tokenString {
+			t, err := time.Parse(dateLayout, tok.value)
+			if err == nil {
+				return Date(t), nil
+			}
+		}
+	case BoolField:
+		if tok.keyword("true") {
+			return true, nil
+		}
+		if tok.keyword("false") {
+			return false, nil
+		}
+	}
+
+	if tok.kind == tokenEOF || tok.kind == tokenRParen || tok.kind == tokenComma {
+		return nil, p.unexpected(tok)
+	}
+	return nil, fmt.Errorf("%w: value %s for operator %q must be %s", ErrInvalidFilter, tok.text, op, field.Type)
+}
+
+// escapeLike escapes the LIKE wildcard characters in a string, so that the "~"
+// operator always performs a literal substring match.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A safelist with a boolean field, which none of the real resources have.
+var testFilterSafelist = FilterSafelist{
+	Fields: map[string]FilterField{
+		"id":     {Column: "t.id", Type: IntField},
+		"name":   {Column: "t.name", Type: StringField},
+		"active": {Column: "t.active", Type: BoolField},
+	},
+}
+
+func TestCompileFilter(t *testing.T) {
+	date := func(s string) Date {
+		d, err := time.Parse(dateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Date(d)
+	}
+
+	tests := []struct {
+		name      string
+		expr      string
+		safelist  FilterSafelist
+		firstArg  int
+		condition string
+		args      []interface{}
+		joins     []string
+	}{
+		{
+			name:      "Empty",
+			expr:      "  ",
+			safelist:  SongFilterSafelist,
+			condition: "TRUE",
+		},
+		{
+			name:      "AND binds tighter than OR",
+			expr:      `length>=180 and title="x" or albumId=1`,
+			safelist:  SongFilterSafelist,
+			condition: "((song.length >= $1 AND song.title = $2) OR song.album_id = $3)",
+			args:      []interface{}{int64(180), "x", int64(1)},
+		},
+		{
+			name:      "Parentheses",
+			expr:      `length>=180 AND (title="x" OR albumId=1)`,
+			safelist:  SongFilterSafelist,
+			condition: "(song.length >= $1 AND (song.title = $2 OR song.album_id = $3))",
+			args:      []interface{}{int64(180), "x", int64(1)},
+		},
+		{
+			name:      "NOT applies to one comparison",
+			expr:      `not title="x" and length<3`,
+			safelist:  SongFilterSafelist,
+			condition: "((NOT song.title = $1) AND song.length < $2)",
+			args:      []interface{}{"x", int64(3)},
+		},
+		{
+			name:      "NOT with parentheses",
+			expr:      `not (title="x" and length<3)`,
+			safelist:  SongFilterSafelist,
+			condition: "(NOT (song.title = $1 AND song.length < $2))",
+			args:      []interface{}{"x", int64(3)},
+		},
+		{
+			name:      "Operators",
+			expr:      `id=1 and id!=2 and id<>3 and id<4 and id<=5 and id>6 and id>=-7`,
+			safelist:  SongFilterSafelist,
+			condition: "((((((song.song_id = $1 AND song.song_id <> $2) AND song.song_id <> $3) AND song.song_id < $4) AND song.song_id <= $5) AND song.song_id > $6) AND song.song_id >= $7)",
+			args:      []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(-7)},
+		},
+		{
+			name:      "IN",
+			expr:      `title in ("a", 'b') and length not in (1)`,
+			safelist:  SongFilterSafelist,
+			condition: "(song.title IN ($1, $2) AND song.length NOT IN ($3))",
+			args:      []interface{}{"a", "b", int64(1)},
+		},
+		{
+			name:      "BETWEEN",
+			expr:      `album.releaseDate between "2018-01-01" and "2020-12-31" or length not between 1 and 2`,
+			safelist:  SongFilterSafelist,
+			condition: "(album.release_date BETWEEN $1 AND $2 OR song.length NOT BETWEEN $3 AND $4)",
+			args:      []interface{}{date("2018-01-01"), date("2020-12-31"), int64(1), int64(2)},
+			joins:     []string{"album"},
+		},
+		{
+			name:      "IS NULL",
+			expr:      `length IS NULL or trackNumber is not null`,
+			safelist:  SongFilterSafelist,
+			condition: "(song.length IS NULL OR song.track_number IS NOT NULL)",
+		},
+		{
+			name:      "Booleans",
+			expr:      `active=true or active != FALSE`,
+			safelist:  testFilterSafelist,
+			condition: "(t.active = $1 OR t.active <> $2)",
+			args:      []interface{}{true, false},
+		},
+		{
+			name:      "LIKE wildcards are escaped",
+			expr:      `name~"50%_off\\"`,
+			safelist:  testFilterSafelist,
+			condition: "t.name ILIKE '%' || $1::text || '%'",
+			args:      []interface{}{`50\%\_off\\`},
+		},
+		{
+			name:      "Quotes in strings",
+			expr:      `name="it's" or name='say "hi"' or name="\"x\""`,
+			safelist:  testFilterSafelist,
+			condition: "((t.name = $1 OR t.name = $2) OR t.name = $3)",
+			args:      []interface{}{"it's", `say "hi"`, `"x"`},
+		},
+		{
+			name:      "Placeholders start at firstArg",
+			expr:      `id=1 or name in ("a", "b")`,
+			safelist:  testFilterSafelist,
+			firstArg:  4,
+			condition: "(t.id = $4 OR t.name IN ($5, $6))",
+			args:      []interface{}{int64(1), "a", "b"},
+		},
+		{
+			name:      "Joins are collected in safelist order",
+			expr:      `album.group.name="BTS" or album.title="x"`,
+			safelist:  SongFilterSafelist,
+			condition: "(groups.name = $1 OR album.title = $2)",
+			args:      []interface{}{"BTS", "x"},
+			joins:     []string{"album", "album.group"},
+		},
+		{
+			name:      "Nested to the maximum depth",
+			expr:      strings.Repeat("(", maxFilterDepth) + "id=1" + strings.Repeat(")", maxFilterDepth),
+			safelist:  testFilterSafelist,
+			condition: "t.id = $1",
+			args:      []interface{}{int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			firstArg := tt.firstArg
+			if firstArg == 0 {
+				firstArg = 1
+			}
+
+			got, err := compileFilter(tt.expr, tt.safelist, firstArg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.condition != tt.condition {
+				t.Errorf("got condition %q; want %q", got.condition, tt.condition)
+			}
+			if !reflect.DeepEqual(got.args, tt.args) {
+				t.Errorf("got args %#v; want %#v", got.args, tt.args)
+			}
+			if !reflect.DeepEqual(got.joins, tt.joins) {
+				t.Errorf("got joins %q; want %q", got.joins, tt.joins)
+			}
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	comparisons := func(n int) string {
+		return strings.TrimSuffix(strings.Repeat("id=1 or ", n), " or ")
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		message string
+	}{
+		{"Double equals", "id==180", `unknown operator "==" at position 3`},
+		{"Tilde equals", `name~="a"`, `unknown operator "~=" at position 5`},
+		{"Bang", "id!1", `unknown operator "!" at position 3`},
+		{"Unknown character", "id=1 & id=2", `unexpected "&" at position 6`},
+		{"Unknown field", "length=1", `unknown field "length"`},
+		{"Wrong value type", `id="1"`, `value "1" for operator "=" must be an integer`},
+		{"Integer out of range", "id=99999999999", `value 99999999999 for operator "=" must be an integer`},
+		{"Substring match on an integer", `id~"1"`, `operator "~" can only be used with string fields`},
+		{"Ordering booleans", "active>true", `operator ">" can't be used with boolean fields`},
+		{"Unterminated string", `name="abc`, "unterminated string at position 6"},
+		{"Missing value", "id=", "unexpected end of expression"},
+		{"Missing parenthesis", "(id=1", "unexpected end of expression"},
+		{"Trailing tokens", "id=1 id=2", `unexpected "id" at position 6`},
+		{"Empty IN list", "id in ()", `unexpected ")" at position 8`},
+		{"IS without NULL", "id is 1", `unexpected "1" at position 7`},
+		{"Too deep", strings.Repeat("(", maxFilterDepth+1) + "id=1" + strings.Repeat(")", maxFilterDepth+1), "must not be nested more than 20 levels deep"},
+		{"Too deep with NOT", strings.Repeat("not ", maxFilterDepth+1) + "id=1", "must not be nested more than 20 levels deep"},
+		{"Too many comparisons", comparisons(maxFilterComparisons + 1), "must not contain more than 50 comparisons"},
+		{"Too long", `name="` + strings.Repeat("a", maxFilterLength) + `"`, "must not be more than 1000 bytes long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileFilter(tt.expr, testFilterSafelist, 1)
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Fatalf("got %v; want ErrInvalidFilter", err)
+			}
+			if want := ErrInvalidFilter.Error() + ": " + tt.message; err.Error() != want {
+				t.Errorf("got %q; want %q", err.Error(), want)
+			}
+		})
+	}
+
+	// The limits themselves are allowed.
+	if _, err := compileFilter(comparisons(maxFilterComparisons), testFilterSafelist, 1); err != nil {
+		t.Errorf("%d comparisons: unexpected error: %v", maxFilterComparisons, err)
+	}
+}
@@ -1,16 +1,23 @@
 package data
 
 import (
+	"fmt"
 	"strings"
 	"math"
 	"goproject/internal/validator" 
 )
 
+// The maximum number of comma-separated keys in the sort parameter.
+const maxSortKeys = 5
+
 type Filters struct {
 	Page 		int
 	PageSize 	int
 	Sort 		string
 	SortSafelist []string
+	Cursor		string
+	Filter		string
+	FilterSafelist FilterSafelist
 }
 
 // Define a new Metadata struct for holding the pagination metadata.
@@ -20,6 +27,9 @@ type Metadata struct {
 	FirstPage int `json:"first_page,omitempty"`
 	LastPage int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Facets map[string][]FacetCount `json:"facets,omitempty"`
 }
 	
 
@@ -44,27 +54,95 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 }
 	
 
-// Check that the client-provided Sort field matches one of the entries in our safelist
-// and if it does, extract the column name from the Sort field by stripping the leading
-// hyphen character (if one exists).
-func (f Filters) sortColumn() string {
+// Split the client-provided Sort field into its keys. Several keys can be given,
+// separated by commas, for example "-length,title".
+func (f Filters) sortValues() []string {
+	return strings.Split(f.Sort, ",")
+}
+
+// Check that a sort key matches one of the entries in our safelist and if it does,
+// extract the column name from it by stripping the leading hyphen character (if one
+// exists).
+func (f Filters) sortColumn(value string) string {
 	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+		if value == safeValue {
+			return strings.TrimPrefix(value, "-")
 		}
 	}
-	panic("unsafe sort parameter: " + f.Sort)
+	panic("unsafe sort parameter: " + value)
 }
 
-// Return the sort direction ("ASC" or "DESC") depending on the prefix character of the
-// Sort field.
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+// Return the sort direction ("ASC" or "DESC") depending on the prefix character of a
+// sort key.
+func (f Filters) sortDirection(value string) string {
+	if strings.HasPrefix(value, "-") {
 		return "DESC"
 	}
 	return "ASC"
 }
 
+// Return the SQL expression for a sort column, along with the joins it needs. Sort
+// values use the same camelCase field names as the JSON responses and the filter
+// expression language, for example "releaseDate" or "album.group.name", so they are
+// looked up in the FilterSafelist.
+func (f Filters) sortExpr(column string) (string, []string) {
+	field, ok := f.FilterSafelist.Fields[column]
+	if !ok {
+		panic("sort column missing from the filter safelist: " + column)
+	}
+	return field.Column, field.Joins
+}
+
+// Return the keys the results are ordered by: each sort key in turn, followed by the
+// table's ID column as a tiebreaker in the direction of the first key, so that the
+// ordering is total and can be used for keyset pagination.
+func (f Filters) sortKeys(table, idColumn string) []sortKey {
+	values := f.sortValues()
+	idExpr := table + "." + idColumn
+
+	var keys []sortKey
+	for _, value := range values {
+		expr, _ := f.sortExpr(f.sortColumn(value))
+		keys = append(keys, sortKey{expr: expr, desc: f.sortDirection(value) == "DESC"})
+		if expr == idExpr {
+			// The ID is unique, so any further keys would never be compared.
+			return keys
+		}
+	}
+
+	return append(keys, sortKey{expr: idExpr, desc: f.sortDirection(values[0]) == "DESC"})
+}
+
+// Return the FROM clause for a listing: the table itself followed by the joins needed
+// by either the compiled filter or the sort keys, each one only once and in the order
+// they are listed in the FilterSafelist.
+func (f Filters) fromClause(table string, filter *compiledFilter) string {
+	used := map[string]bool{}
+	for _, name := range filter.joins {
+		used[name] = true
+	}
+	for _, value := range f.sortValues() {
+		_, joins := f.sortExpr(f.sortColumn(value))
+		for _, name := range joins {
+			used[name] = true
+		}
+	}
+
+	clauses := []string{table}
+	for _, join := range f.FilterSafelist.Joins {
+		if used[join.Name] {
+			clauses = append(clauses, join.Clause)
+		}
+	}
+	return strings.Join(clauses, "\n\t\t")
+}
+
+// Compile the client-provided filter expression against the FilterSafelist. The
+// placeholders in the returned condition are numbered starting from firstArg.
+func (f Filters) filterCondition(firstArg int) (*compiledFilter, error) {
+	return compileFilter(f.Filter, f.FilterSafelist, firstArg)
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -80,7 +158,28 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	// Check that the sort parameter matches a value in the safelist.
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// Check that every key of the sort parameter matches a value in the safelist, and
+	// that no column is sorted on twice.
+	values := f.sortValues()
+	columns := make([]string, len(values))
+	for i, value := range values {
+		v.Check(validator.In(value, f.SortSafelist...), "sort", "invalid sort value")
+		columns[i] = strings.TrimPrefix(value, "-")
+	}
+	v.Check(len(values) <= maxSortKeys, "sort", fmt.Sprintf("must not have more than %d keys", maxSortKeys))
+	v.Check(validator.Unique(columns), "sort", "must not sort on the same column twice")
+	// Check that the filter expression parses and only refers to safelisted fields.
+	if _, err := f.filterCondition(1); err != nil {
+		v.AddError("filter", strings.TrimPrefix(err.Error(), ErrInvalidFilter.Error()+": "))
+	}
+	// A cursor is only valid for the sort it was created with.
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "must be a cursor returned by a previous request")
+		} else {
+			v.Check(c.Sort == f.Sort, "cursor", "does not match the sort parameter")
+		}
+	}
 }
 	
\ No newline at end of file
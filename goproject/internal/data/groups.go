@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"goproject/internal/validator"
+)
+
+type Group struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	NumOfMembers int    `json:"numOfMembers"`
+	LaunchDate   Date   `json:"launchDate"`
+}
+
+func ValidateGroup(v *validator.Validator, group *Group) {
+	v.Check(group.Name != "", "name", "must be provided")
+	v.Check(len(group.Name) <= 25, "name", "must not be more than 25 bytes long")
+	v.Check(group.NumOfMembers > 0, "numOfMembers", "must be greater than 0")
+	v.Check(!group.LaunchDate.Time().After(time.Now()), "launchDate", "must not be in the future")
+}
+
+// Define a GroupModel struct type which wraps a sql.DB connection pool.
+type GroupModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert a new record in the groups table. If no launch date was supplied we fall back
+// to the column default (the current date).
+func (g GroupModel) Insert(ctx context.Context, group *Group) error {
+	query := `
+		INSERT INTO groups(name, num_of_members, launch_date)
+		VALUES ($1, $2, COALESCE($3, CURRENT_DATE))
+		RETURNING group_id, name, num_of_members, launch_date;`
+
+	args := []interface{}{group.Name, group.NumOfMembers, group.LaunchDate}
+
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&group.Id, &group.Name, &group.NumOfMembers, &group.LaunchDate)
+	return mapConstraintError(err)
+}
+
+// Fetch a specific record from the groups table.
+func (g GroupModel) Get(ctx context.Context, id int64) (*Group, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT group_id, name, num_of_members, launch_date
+		FROM groups
+		WHERE group_id = $1;`
+
+	var group Group
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.Read)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, annotate(ctx, query), id).Scan(&group.Id, &group.Name, &group.NumOfMembers, &group.LaunchDate)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &group, nil
+}
+
+// GetMany returns the groups with the given IDs, keyed by ID, in a single query. IDs
+// without a matching record are simply missing from the map.
+func (g GroupModel) GetMany(ctx context.Context, ids []int64) (map[int]*Group, error) {
+	groups := map[int]*Group{}
+	if len(ids) == 0 {
+		return groups, nil
+	}
+
+	query := `
+		SELECT group_id, name, num_of_members, launch_date
+		FROM groups
+		WHERE group_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.Read)
+	defer cancel()
+
+	rows, err := g.DB.QueryContext(ctx, annotate(ctx, query), pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var group Group
+		err := rows.Scan(&group.Id, &group.Name, &group.NumOfMembers, &group.LaunchDate)
+		if err != nil {
+			return nil, err
+		}
+		groups[group.Id] = &group
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Update a specific record in the groups table. As with Insert(), a missing launch
+// date is not written, so the group keeps the one it has.
+func (g GroupModel) Update(ctx context.Context, group *Group) error {
+	query := `
+		UPDATE groups
+		SET name = $1, num_of_members = $2, launch_date = COALESCE($3, launch_date)
+		WHERE group_id = $4
+		RETURNING group_id, name, num_of_members, launch_date;`
+
+	args := []interface{}{group.Name, group.NumOfMembers, group.LaunchDate, group.Id}
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&group.Id, &group.Name, &group.NumOfMembers, &group.LaunchDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return mapConstraintError(err)
+}
+
+// Delete a specific record from the groups table.
+func (g GroupModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM groups
+		WHERE group_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
+
+	result, err := g.DB.ExecContext(ctx, annotate(ctx, query), id)
+	if err != nil {
+		return mapDeleteError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of groups, optionally filtered by a full-text match on the
+// group name and a filter expression, together with the pagination metadata.
+func (g GroupModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Group, Metadata, error) {
+	args := []interface{}{name}
+
+	filter, err := filters.filterCondition(len(args) + 1)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	args = append(args, filter.args...)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), groups.group_id, groups.name, groups.num_of_members, groups.launch_date
+		FROM %s
+		WHERE (to_tsvector('simple', groups.name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, filters.fromClause("groups", filter), filter.condition,
+		orderByClause(filters.sortKeys("groups", "group_id"), false), len(args)+1, len(args)+2)
+
+	ctx, cancel := context.WithTimeout(ctx, g.Timeouts.List)
+	defer cancel()
+
+	args = append(args, filters.limit(), filters.offset())
+
+	rows, err := g.DB.QueryContext(ctx, annotate(ctx, query), args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	groups := []*Group{}
+
+	for rows.Next() {
+		var group Group
+		err := rows.Scan(
+			&totalRecords,
+			&group.Id,
+			&group.Name,
+			&group.NumOfMembers,
+			&group.LaunchDate,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		groups = append(groups, &group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return groups, metadata, nil
+}
@@ -1,34 +1,105 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 // Define a custom ErrRecordNotFound error. We'll return this from our Get() method when
 // looking up a movie that doesn't exist in our database.
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Timeouts holds the deadlines for the different kinds of database operations. Reads
+// look up single records, lists return pages of records or reports over them, and
+// writes change data. The deadline applies on top of the context passed in by the
+// caller, so a query is also canceled when the client goes away.
+type Timeouts struct {
+	Read  time.Duration
+	List  time.Duration
+	Write time.Duration
+}
+
 // Create a Models struct which wraps the MovieModel. We'll add other models to this,
 // like a UserModel and PermissionModel, as our build progresses.
 type Models struct {
 	// Set the Movies field to be an interface containing the methods that both the
 	// 'real' model and mock model need to support.
 	Songs interface{
-		Insert(song *Song) error
-		Get(id int64) (*Song, error)
-		GetAll(title string, length int, filters Filters) ([]*Song, Metadata, error)
-		Update(song *Song) error
-		Delete(id int64) error
+		Insert(ctx context.Context, song *Song) error
+		Get(ctx context.Context, id int64) (*Song, error)
+		GetAll(ctx context.Context, title string, length int, hasLength *bool, filters Filters) ([]*Song, Metadata, error)
+		GetFacets(ctx context.Context, title string, length int, hasLength *bool, filters Filters, facets []string) (map[string][]FacetCount, error)
+		Update(ctx context.Context, song *Song) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Groups interface{
+		Insert(ctx context.Context, group *Group) error
+		Get(ctx context.Context, id int64) (*Group, error)
+		GetMany(ctx context.Context, ids []int64) (map[int]*Group, error)
+		GetAll(ctx context.Context, name string, filters Filters) ([]*Group, Metadata, error)
+		GetDiscography(ctx context.Context, id int64) (*Discography, error)
+		Update(ctx context.Context, group *Group) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Singers interface{
+		Insert(ctx context.Context, singer *Singer) error
+		Get(ctx context.Context, id int64) (*Singer, error)
+		GetAll(ctx context.Context, name string, groupId int, filters Filters) ([]*Singer, Metadata, error)
+		GetAllForGroup(ctx context.Context, groupId int64) ([]*Singer, error)
+		Update(ctx context.Context, singer *Singer) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Albums interface{
+		Insert(ctx context.Context, album *Album) error
+		Get(ctx context.Context, id int64) (*Album, error)
+		GetMany(ctx context.Context, ids []int64) (map[int]*Album, error)
+		GetAll(ctx context.Context, title string, genre string, groupId int, filters Filters) ([]*Album, Metadata, error)
+		GetSongs(ctx context.Context, id int64) ([]*Song, error)
+		CountSongs(ctx context.Context, id int64, excludeSongId int) (int, error)
+		Update(ctx context.Context, album *Album) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Users interface{
+		Insert(ctx context.Context, user *User) error
+		Register(ctx context.Context, user *User, activationTTL time.Duration, permissions ...string) (*Token, error)
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+		Update(ctx context.Context, user *User) error
+	}
+	Tokens interface{
+		New(ctx context.Context, userId int64, ttl time.Duration, scope string) (*Token, error)
+		Insert(ctx context.Context, token *Token) error
+		DeleteAllForUser(ctx context.Context, scope string, userId int64) error
+	}
+	Permissions interface{
+		GetAllForUser(ctx context.Context, userId int64) (Permissions, error)
+		AddForUser(ctx context.Context, userId int64, codes ...string) error
+	}
+	ApiKeys interface{
+		Insert(ctx context.Context, key *ApiKey) error
+		GetAll(ctx context.Context) ([]*ApiKey, error)
+		Rotate(ctx context.Context, id int64) (*ApiKey, error)
+		Revoke(ctx context.Context, id int64) error
+		GetForPlaintext(ctx context.Context, keyPlaintext string) (*ApiKey, error)
 	}
 }
 
-// Create a helper function which returns a Models instance containing the mock models
-// only.
-func NewModels(db *sql.DB) Models {
+// Create a helper function which returns a Models instance containing the real models,
+// all sharing the connection pool and the operation timeouts.
+func NewModels(db *sql.DB, timeouts Timeouts) Models {
 	return Models{
-		Songs: SongModel{DB: db},
+		Songs: SongModel{DB: db, Timeouts: timeouts},
+		Groups: GroupModel{DB: db, Timeouts: timeouts},
+		Singers: SingerModel{DB: db, Timeouts: timeouts},
+		Albums: AlbumModel{DB: db, Timeouts: timeouts},
+		Users: UserModel{DB: db, Timeouts: timeouts},
+		Tokens: TokenModel{DB: db, Timeouts: timeouts},
+		Permissions: PermissionModel{DB: db, Timeouts: timeouts},
+		ApiKeys: ApiKeyModel{DB: db, Timeouts: timeouts},
 	}
 }
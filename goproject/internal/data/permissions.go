@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// CatalogPermissions are the permission codes guarding the songs, groups, singers and
+// albums endpoints. API keys may only be given permissions from this list.
+var CatalogPermissions = []string{
+	"songs:read", "songs:write",
+	"groups:read", "groups:write",
+	"singers:read", "singers:write",
+	"albums:read", "albums:write",
+}
+
+// DefaultPermissions are the permission codes granted to every newly registered user,
+// which give read-only access to the catalog. Write access has to be granted
+// separately.
+var DefaultPermissions = []string{"songs:read", "groups:read", "singers:read", "albums:read"}
+
+// Define a Permissions slice, which we will use to hold the permission codes (like
+// "songs:read" and "songs:write") for a single user.
+type Permissions []string
+
+// Add a helper method to check whether the Permissions slice contains a specific
+// permission code.
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Define the PermissionModel type.
+type PermissionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// The GetAllForUser() method returns all permission codes for a specific user in a
+// Permissions slice.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userId int64) (Permissions, error) {
+	query := `
+		SELECT permission.code
+		FROM permission
+		INNER JOIN user_permission ON user_permission.permission_id = permission.permission_id
+		INNER JOIN users ON user_permission.user_id = users.user_id
+		WHERE users.user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, annotate(ctx, query), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Add the provided permission codes for a specific user. Notice that we're using a
+// variadic parameter for the codes so that we can assign multiple permissions in a
+// single call. Codes the user already has are skipped.
+func (m PermissionModel) AddForUser(ctx context.Context, userId int64, codes ...string) error {
+	query := `
+		INSERT INTO user_permission
+		SELECT $1, permission.permission_id FROM permission WHERE permission.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, annotate(ctx, query), userId, pq.Array(codes))
+	return err
+}
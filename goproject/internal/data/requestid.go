@@ -0,0 +1,43 @@
+package data
+
+import (
+	"context"
+	"regexp"
+
+	"goproject/internal/validator"
+)
+
+// Request IDs are limited to characters that are safe to put in a log line, a response
+// header and a SQL comment.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDKey is the context key for the ID of the request a query is run for.
+type requestIDKey struct{}
+
+// ValidRequestID reports whether a request ID sent by a client can be used as is.
+func ValidRequestID(id string) bool {
+	return validator.Matches(id, requestIDRX)
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID. Queries run with
+// the returned context are tagged with it.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// The annotate() helper prefixes a query with a comment naming the request it is run
+// for, so that entries in the PostgreSQL slow query log can be matched up with our own
+// logs. Queries run outside of a request are left unchanged.
+func annotate(ctx context.Context, query string) string {
+	id := RequestIDFromContext(ctx)
+	if !ValidRequestID(id) {
+		return query
+	}
+	return "/* request_id=" + id + " */" + query
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"goproject/internal/validator"
+)
+
+// Singer represents a row in the singer table. GroupId is a pointer because the
+// group_id column is nullable: solo artists don't belong to any group.
+type Singer struct {
+	Id        int    `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Birthday  Date   `json:"birthday"`
+	GroupId   *int   `json:"groupId"`
+}
+
+func ValidateSinger(v *validator.Validator, singer *Singer) {
+	v.Check(singer.FirstName != "", "firstName", "must be provided")
+	v.Check(len(singer.FirstName) <= 25, "firstName", "must not be more than 25 bytes long")
+	v.Check(singer.LastName != "", "lastName", "must be provided")
+	v.Check(len(singer.LastName) <= 25, "lastName", "must not be more than 25 bytes long")
+	v.Check(!singer.Birthday.IsZero(), "birthday", "must be provided in YYYY-MM-DD format")
+	v.Check(singer.Birthday.Time().Year() >= 1900, "birthday", "must be after 1900")
+	v.Check(!singer.Birthday.Time().After(time.Now()), "birthday", "must not be in the future")
+	if singer.GroupId != nil {
+		v.Check(*singer.GroupId > 0, "groupId", "must be greater than 0")
+	}
+}
+
+// Define a SingerModel struct type which wraps a sql.DB connection pool.
+type SingerModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert a new record in the singer table.
+func (s SingerModel) Insert(ctx context.Context, singer *Singer) error {
+	query := `
+		INSERT INTO singer(first_name, last_name, birthday, group_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING singer_id, first_name, last_name, birthday, group_id;`
+
+	args := []interface{}{singer.FirstName, singer.LastName, singer.Birthday, singer.GroupId}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&singer.Id, &singer.FirstName, &singer.LastName, &singer.Birthday, &singer.GroupId)
+	return mapConstraintError(err)
+}
+
+// Fetch a specific record from the singer table.
+func (s SingerModel) Get(ctx context.Context, id int64) (*Singer, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT singer_id, first_name, last_name, birthday, group_id
+		FROM singer
+		WHERE singer_id = $1;`
+
+	var singer Singer
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Read)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, annotate(ctx, query), id).Scan(&singer.Id, &singer.FirstName, &singer.LastName, &singer.Birthday, &singer.GroupId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &singer, nil
+}
+
+// Update a specific record in the singer table.
+func (s SingerModel) Update(ctx context.Context, singer *Singer) error {
+	query := `
+		UPDATE singer
+		SET first_name = $1, last_name = $2, birthday = $3, group_id = $4
+		WHERE singer_id = $5
+		RETURNING singer_id, first_name, last_name, birthday, group_id;`
+
+	args := []interface{}{singer.FirstName, singer.LastName, singer.Birthday, singer.GroupId, singer.Id}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&singer.Id, &singer.FirstName, &singer.LastName, &singer.Birthday, &singer.GroupId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return mapConstraintError(err)
+}
+
+// Delete a specific record from the singer table.
+func (s SingerModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM singer
+		WHERE singer_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, annotate(ctx, query), id)
+	if err != nil {
+		return mapDeleteError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of singers. The name parameter is matched against both the
+// first and last name, a non-zero groupId restricts the results to one group and
+// filters.Filter can narrow them down further.
+func (s SingerModel) GetAll(ctx context.Context, name string, groupId int, filters Filters) ([]*Singer, Metadata, error) {
+	args := []interface{}{name, groupId}
+
+	filter, err := filters.filterCondition(len(args) + 1)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	args = append(args, filter.args...)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), singer.singer_id, singer.first_name, singer.last_name, singer.birthday, singer.group_id
+		FROM %s
+		WHERE (to_tsvector('simple', singer.first_name || ' ' || singer.last_name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (singer.group_id = $2 OR $2 = 0)
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, filters.fromClause("singer", filter), filter.condition,
+		orderByClause(filters.sortKeys("singer", "singer_id"), false), len(args)+1, len(args)+2)
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.List)
+	defer cancel()
+
+	args = append(args, filters.limit(), filters.offset())
+
+	rows, err := s.DB.QueryContext(ctx, annotate(ctx, query), args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	singers := []*Singer{}
+
+	for rows.Next() {
+		var singer Singer
+		err := rows.Scan(
+			&totalRecords,
+			&singer.Id,
+			&singer.FirstName,
+			&singer.LastName,
+			&singer.Birthday,
+			&singer.GroupId,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		singers = append(singers, &singer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return singers, metadata, nil
+}
+
+// GetAllForGroup returns every member of a group ordered by singer ID. Unlike GetAll()
+// it isn't paginated, as a group roster is always small.
+func (s SingerModel) GetAllForGroup(ctx context.Context, groupId int64) ([]*Singer, error) {
+	query := `
+		SELECT singer_id, first_name, last_name, birthday, group_id
+		FROM singer
+		WHERE group_id = $1
+		ORDER BY singer_id`
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.List)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, annotate(ctx, query), groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	singers := []*Singer{}
+
+	for rows.Next() {
+		var singer Singer
+		err := rows.Scan(&singer.Id, &singer.FirstName, &singer.LastName, &singer.Birthday, &singer.GroupId)
+		if err != nil {
+			return nil, err
+		}
+		singers = append(singers, &singer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return singers, nil
+}
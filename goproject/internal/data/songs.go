@@ -5,7 +5,6 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"time"
 	"fmt"
 
 	//"github.com/lib/pq"
@@ -15,14 +14,22 @@ import (
 type Song struct{
 	Id 			int		`json:"id"`
 	Title 		string	`json:"title"`
-	Length 		int		`json:"length"`
+	Length 		*int	`json:"length"`
 	Album_id	int 	`json:"albumId"`
+	TrackNumber	*int	`json:"trackNumber"`
+	Version		int32	`json:"version"`
 } 
 
 func ValidateSong(v *validator.Validator, song *Song){
 	v.Check(song.Title != "", "title", "must be provided")
-	v.Check(song.Id > 0, "id", "must be greater than 0")
 	v.Check(song.Album_id != 0, "albumId", "must be greater than 0")
+	// The length column is nullable, so a nil Length simply means "unknown".
+	if song.Length != nil {
+		v.Check(*song.Length > 0, "length", "must be greater than 0")
+	}
+	if song.TrackNumber != nil {
+		v.Check(*song.TrackNumber > 0, "trackNumber", "must be greater than 0")
+	}
 }
 /*
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -43,50 +50,52 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 // Define a MovieModel struct type which wraps a sql.DB connection pool.
 
 type SongModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
 }
 
 // Add a placeholder method for inserting a new record in the movies table.
-func (s SongModel) Insert(song *Song) error {
+func (s SongModel) Insert(ctx context.Context, song *Song) error {
 	// Define the SQL query for inserting a new record in the movies table and returning
 	// the system-generated data.
 	query := `
-		INSERT INTO song(song_id, title, length, album_id)
+		INSERT INTO song(title, length, album_id, track_number)
 		VALUES ($1, $2, $3, $4)
-		RETURNING song_id, title, length, album_id;`
+		RETURNING song_id, title, length, album_id, track_number, version;`
 
 	// Create an args slice containing the values for the placeholder parameters from
 	// the movie struct. Declaring this slice immediately next to our SQL query helps to
 	// make it nice and clear *what values are being used where* in the query.
-	args := []interface{}{song.Id, song.Title, song.Length, song.Album_id}
+	args := []interface{}{song.Title, song.Length, song.Album_id, song.TrackNumber}
 
 	// Use the QueryRow() method to execute the SQL query on our connection pool,
 	// passing in the args slice as a variadic parameter and scanning the system-
 	// generated id, created_at and version values into the movie struct.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Write)
 	defer cancel()
 
-	return s.DB.QueryRowContext(ctx, query, args...).Scan(&song.Id, &song.Title, &song.Length, &song.Album_id)
+	err := s.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&song.Id, &song.Title, &song.Length, &song.Album_id, &song.TrackNumber, &song.Version)
+	return mapConstraintError(err)
 }
 
 // Add a placeholder method for fetching a specific record from the movies table.
-func (s SongModel) Get(id int64) (*Song, error) {
+func (s SongModel) Get(ctx context.Context, id int64) (*Song, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	// Retrieve a specific menu item based on its ID.
 	query := `
-		SELECT song_id, title, length, album_id
+		SELECT song_id, title, length, album_id, track_number, version
 		FROM song
 		WHERE song_id = $1;`
 
 	var song Song
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Read)
 	defer cancel()
 
-	row := s.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&song.Id, &song.Title, &song.Length, &song.Album_id)
+	row := s.DB.QueryRowContext(ctx, annotate(ctx, query), id)
+	err := row.Scan(&song.Id, &song.Title, &song.Length, &song.Album_id, &song.TrackNumber, &song.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -98,24 +107,32 @@ func (s SongModel) Get(id int64) (*Song, error) {
 	return &song, nil
 }
 
-// Add a placeholder method for updating a specific record in the movies table.
-func (s SongModel) Update(song *Song) error {
+// Update a specific record in the song table. The version column is used for
+// optimistic locking: the update is only applied if the version is still the one we
+// read, and it is incremented on every successful write. If no row matches, someone
+// else has changed (or deleted) the song in the meantime and ErrEditConflict is
+// returned.
+func (s SongModel) Update(ctx context.Context, song *Song) error {
 	query := `
 		UPDATE song
-		SET title = $1, length = $2, album_id = $3
-		WHERE song_id = $4
-		RETURNING song_id, title, length, album_id;
+		SET title = $1, length = $2, album_id = $3, track_number = $4, version = version + 1
+		WHERE song_id = $5 AND version = $6
+		RETURNING song_id, title, length, album_id, track_number, version;
 		`
 
-	args := []interface{}{song.Title, song.Length, song.Album_id, song.Id}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []interface{}{song.Title, song.Length, song.Album_id, song.TrackNumber, song.Id, song.Version}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Write)
 	defer cancel()
 
-	return s.DB.QueryRowContext(ctx, query, args...).Scan(&song.Id, &song.Title, &song.Length, &song.Album_id)
+	err := s.DB.QueryRowContext(ctx, annotate(ctx, query), args...).Scan(&song.Id, &song.Title, &song.Length, &song.Album_id, &song.TrackNumber, &song.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return mapConstraintError(err)
 }
 
 
-func (s SongModel) Delete(id int64) error {
+func (s SongModel) Delete(ctx context.Context, id int64) error {
 	// Return an ErrRecordNotFound error if the movie ID is less than 1.
 	if id < 1 {
 		return ErrRecordNotFound
@@ -125,12 +142,12 @@ func (s SongModel) Delete(id int64) error {
 		DELETE FROM song
 		WHERE song_id = $1
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.Write)
 	defer cancel()
 
-	result, err := s.DB.ExecContext(ctx, query, id)
+	result, err := s.DB.ExecContext(ctx, annotate(ctx, query), id)
 	if err != nil {
-		return err
+		return mapDeleteError(err)
 	}
 
 	// Call the RowsAffected() method on the sql.Result object to get the number of rows
@@ -152,39 +169,72 @@ func (s SongModel) Delete(id int64) error {
 
 // Create a new GetAll() method which returns a slice of movies. Although we're not
 // using them right now, we've set this up to accept the various filter parameters as
-// arguments.
-func (s SongModel) GetAll(title string, length int, filters Filters) ([]*Song, Metadata, error) {
-	// Construct the SQL query to retrieve all movie records.
-	query :=  fmt.Sprintf(`
-		SELECT count(*) OVER(), song_id, title, length, album_id
-		FROM song
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (length = $2 OR $2 = 1)
-		ORDER BY %s %s, song_id
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-	
-/*SELECT count(*) OVER(), song_id, title, length, album_id
-		FROM song
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (length = $2 OR $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`
-		WHERE (title ILIKE $1 OR $1 = '')
-		*/
-
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// arguments. A non-nil hasLength restricts the results to songs with (true) or without
+// (false) a known length. A length of 0 means no length filter. Anything more
+// involved is expressed through filters.Filter, the filter expression language.
+//
+// Results are paged with LIMIT/OFFSET unless filters.Cursor is set, in which case
+// keyset pagination is used instead: the query continues directly after (or before)
+// the row the cursor points at, which stays fast and stable on deep pages.
+func (s SongModel) GetAll(ctx context.Context, title string, length int, hasLength *bool, filters Filters) ([]*Song, Metadata, error) {
+	keys := filters.sortKeys("song", "song_id")
 
-	// As our SQL query now has quite a few placeholder parameters, let's collect the
-	// values for the placeholders in a slice. Notice here how we call the limit() and
-	// offset() methods on the Filters struct to get the appropriate values for the
-	// LIMIT and OFFSET clauses.
-	args := []interface{}{title, length, filters.limit(), filters.offset()}
+	var c *cursor
+	if filters.Cursor != "" {
+		var err error
+		c, err = decodeCursor(filters.Cursor)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+	reverse := c != nil && c.Prev
+
+	where, args, filter, err := songConditions(title, length, hasLength, filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	from := filters.fromClause("song", filter)
+
+	if c != nil {
+		condition, conditionArgs, err := keysetCondition(keys, c.Values, reverse, len(args)+1)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		where += "\n\t\tAND " + condition
+		args = append(args, conditionArgs...)
+	}
+
+	// Construct the SQL query. Besides the song itself we select the text form of every
+	// sort key, which is what the next and previous cursors are built from. In offset
+	// mode the total count comes from the window function; in keyset mode we skip it
+	// (it's what makes deep pages slow) and fetch one extra row instead to find out
+	// whether there is another page.
+	var query string
+	if c == nil {
+		query = fmt.Sprintf(`
+		SELECT count(*) OVER(), song.song_id, song.title, song.length, song.album_id, song.track_number, song.version, %s
+		FROM %s
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, sortValueColumns(keys), from, where, orderByClause(keys, false), len(args)+1, len(args)+2)
+		args = append(args, filters.limit(), filters.offset())
+	} else {
+		query = fmt.Sprintf(`
+		SELECT song.song_id, song.title, song.length, song.album_id, song.track_number, song.version, %s
+		FROM %s
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d`, sortValueColumns(keys), from, where, orderByClause(keys, reverse), len(args)+1)
+		args = append(args, filters.limit()+1)
+	}
+
+	// Derive a context from the caller's with the timeout for listings.
+	ctx, cancel := context.WithTimeout(ctx, s.Timeouts.List)
+	defer cancel()
 
 	// Use QueryContext() to execute the query. This returns a sql.Rows resultset
 	// containing the result.
-	rows, err := s.DB.QueryContext(ctx, query, args...)
+	rows, err := s.DB.QueryContext(ctx, annotate(ctx, query), args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -193,27 +243,31 @@ func (s SongModel) GetAll(title string, length int, filters Filters) ([]*Song, M
 	defer rows.Close()
 	// Declare a totalRecords variable.
 	totalRecords := 0
-	// Initialize an empty slice to hold the movie data.
+	// Initialize an empty slice to hold the song data, and one for the sort key values
+	// of each song.
 	songs := []*Song{}
+	positions := [][]*string{}
 
 	// Use rows.Next to iterate through the rows in the resultset.
 	for rows.Next() {
-		// Initialize an empty Movie struct to hold the data for an individual movie.
 		var song Song
-		// Scan the values from the row into the Movie struct. Again, note that we're
-		// using the pq.Array() adapter on the genres field here.
-		err := rows.Scan(
-			&totalRecords, // Scan the count from the window function into totalRecords.
-			&song.Id,
-			&song.Title,
-			&song.Length,
-			&song.Album_id,
-		)
+		position := make([]sql.NullString, len(keys))
+
+		dest := []interface{}{&song.Id, &song.Title, &song.Length, &song.Album_id, &song.TrackNumber, &song.Version}
+		if c == nil {
+			// Scan the count from the window function into totalRecords.
+			dest = append([]interface{}{&totalRecords}, dest...)
+		}
+		for i := range position {
+			dest = append(dest, &position[i])
+		}
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		// Add the Movie struct to the slice.
 		songs = append(songs, &song)
+		positions = append(positions, nullStringPointers(position))
 	}
 	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
 	// that was encountered during the iteration.
@@ -221,9 +275,60 @@ func (s SongModel) GetAll(title string, length int, filters Filters) ([]*Song, M
 		return nil, Metadata{}, err
 	}
 
-	// Generate a Metadata struct, passing in the total record count and pagination
-	// parameters from the client.
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-	// If everything went OK, then return the slice of movies.
+	if c == nil {
+		// Generate a Metadata struct, passing in the total record count and pagination
+		// parameters from the client. Cursors are included as well, so that clients can
+		// switch to keyset pagination after the first page.
+		metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+		hasNext := filters.offset()+len(songs) < totalRecords
+		hasPrev := filters.Page > 1
+		metadata.NextCursor, metadata.PrevCursor = pageCursors(filters.Sort, positions, hasNext, hasPrev)
+		return songs, metadata, nil
+	}
+
+	// In keyset mode, the extra row tells us whether there is another page in the
+	// direction we're walking. Rows fetched backwards are put back in display order.
+	hasMore := len(songs) > filters.limit()
+	if hasMore {
+		songs = songs[:filters.limit()]
+		positions = positions[:filters.limit()]
+	}
+	if reverse {
+		for i, j := 0, len(songs)-1; i < j; i, j = i+1, j-1 {
+			songs[i], songs[j] = songs[j], songs[i]
+			positions[i], positions[j] = positions[j], positions[i]
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+	if reverse {
+		metadata.NextCursor, metadata.PrevCursor = pageCursors(filters.Sort, positions, true, hasMore)
+	} else {
+		metadata.NextCursor, metadata.PrevCursor = pageCursors(filters.Sort, positions, hasMore, true)
+	}
 	return songs, metadata, nil
 }
+
+// songConditions builds the WHERE condition shared by the song listing and its facets
+// from the listing parameters, and returns it together with its arguments and the
+// compiled filter expression.
+func songConditions(title string, length int, hasLength *bool, filters Filters) (string, []interface{}, *compiledFilter, error) {
+	where := `(to_tsvector('simple', song.title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (song.length = $2 OR $2 = 0)
+		AND ($3::boolean IS NULL OR (song.length IS NOT NULL) = $3)`
+
+	// As our SQL query now has quite a few placeholder parameters, let's collect the
+	// values for the placeholders in a slice.
+	args := []interface{}{title, length, hasLength}
+
+	// Compile the filter expression. Both the filter and the sort keys may pull in
+	// joins to the album and groups tables.
+	filter, err := filters.filterCondition(len(args) + 1)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	where += "\n\t\tAND " + filter.condition
+	args = append(args, filter.args...)
+
+	return where, args, filter, nil
+}
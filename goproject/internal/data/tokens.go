@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"time"
+
+	"goproject/internal/validator"
+)
+
+// Define constants for the token scope. Activation tokens are emailed to new users,
+// while authentication tokens are sent by clients in the Authorization header.
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication"
+)
+
+// Define a Token struct to hold the data for an individual token. This includes the
+// plaintext and hashed versions of the token, associated user ID, expiry time and
+// scope. Only the hash is ever stored in the database.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserId    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error) {
+	// Create a Token instance containing the user ID, expiry, and scope information.
+	// Notice that we add the provided ttl (time-to-live) duration parameter to the
+	// current time to get the expiry time.
+	token := &Token{
+		UserId: userId,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	// Initialize a zero-valued byte slice with a length of 16 bytes and fill it with
+	// random bytes from the operating system's CSPRNG.
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the byte slice to a base-32-encoded string and assign it to the token
+	// Plaintext field. This will be the token string that we send to the user. Note
+	// that by default base-32 strings may be padded at the end with the = character.
+	// We don't need this padding character for the purpose of our tokens, so we use
+	// the WithPadding(base32.NoPadding) method in the line below to omit them.
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	// Generate a SHA-256 hash of the plaintext token string. This will be the value
+	// that we store in the hash field of our database table.
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// Check that the plaintext token has been provided and is exactly 26 bytes long.
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+// Define the TokenModel type.
+type TokenModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// The New() method is a shortcut which creates a new Token struct and then inserts the
+// data in the token table.
+func (m TokenModel) New(ctx context.Context, userId int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userId, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+// Insert() adds the data for a specific token to the token table.
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
+	query := `
+		INSERT INTO token (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)`
+
+	args := []interface{}{token.Hash, token.UserId, token.Expiry, token.Scope}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, annotate(ctx, query), args...)
+	return err
+}
+
+// DeleteAllForUser() deletes all tokens for a specific user and scope. This is what
+// makes activation tokens single-use.
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userId int64) error {
+	query := `
+		DELETE FROM token
+		WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, annotate(ctx, query), scope, userId)
+	return err
+}
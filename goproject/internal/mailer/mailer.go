@@ -0,0 +1,104 @@
+// Package mailer sends the emails of the API, such as the welcome email with the
+// activation token for newly registered users. Emails are rendered from the templates
+// embedded in the binary and sent through an SMTP server.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"text/template"
+	"time"
+)
+
+// Below we declare a new variable with the type embed.FS (embedded file system) to hold
+// our email templates. This has a comment directive in the format `//go:embed <path>`
+// IMMEDIATELY ABOVE it, which indicates to Go that we want to store the contents of the
+// ./templates directory in the templateFS embedded file system variable.
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Define a Mailer struct which contains the address and credentials of the SMTP server
+// and the sender information for the emails (the name and address you want the email
+// to be from, such as "Goproject <no-reply@goproject.local>").
+type Mailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+// New returns a Mailer for the given SMTP server. Credentials are optional; without a
+// username, mail is sent without authentication, which is what local relays expect.
+func New(host string, port int, username, password, sender string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return Mailer{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		auth:   auth,
+		sender: sender,
+	}
+}
+
+// Define a Send() method on the Mailer type. This takes the recipient email address
+// as the first parameter, the name of the file containing the templates, and any
+// dynamic data for the templates as an interface{} parameter.
+func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
+	// Use the ParseFS() method to parse the required template file from the embedded
+	// file system.
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	// Execute the named template "subject", passing in the dynamic data and storing the
+	// result in a bytes.Buffer variable.
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	// Follow the same pattern to execute the "plainBody" template and store the result
+	// in the plainBody variable.
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+
+	// The SMTP envelope needs the bare address of the sender, without the name.
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return err
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(msg, "From: %s\r\n", m.sender)
+	fmt.Fprintf(msg, "Subject: %s\r\n", subject.String())
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.Write(plainBody.Bytes())
+
+	// Try sending the email up to three times before aborting and returning the final
+	// error. We sleep for 500 milliseconds between each attempt.
+	for i := 1; i <= 3; i++ {
+		err = smtp.SendMail(m.addr, m.auth, from.Address, []string{recipient}, msg.Bytes())
+		// If everything worked, return nil.
+		if err == nil {
+			return nil
+		}
+
+		// If it didn't work, sleep for a short time and retry.
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return err
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("requests_total", "Requests, with a \\ and a\nnewline.", "route", "code")
+	requests.Inc("/b", "200")
+	requests.Inc("/a", "500")
+	requests.Inc("/b", "200")
+	requests.Inc(`"q"\n`+"\n", "200")
+
+	inFlight := r.NewGaugeVec("in_flight", "In flight.", "route")
+	inFlight.Add(1, "/a")
+	inFlight.Add(1, "/a")
+	inFlight.Add(-1, "/a")
+
+	duration := r.NewHistogramVec("duration_seconds", "Duration.", []float64{0.1, 0.5, 1}, "route")
+	duration.Observe(0.05, "/a")
+	duration.Observe(0.1, "/a")
+	duration.Observe(0.7, "/a")
+	duration.Observe(3, "/a")
+
+	collected := 0
+	r.OnCollect(func() { collected++ })
+	r.NewGaugeFunc("pool_size", "Pool size.", func() float64 { return float64(collected) })
+	r.NewCounterFunc("big_total", "Big.", func() float64 { return math.Inf(1) })
+
+	want := `# HELP requests_total Requests, with a \\ and a\nnewline.
+# TYPE requests_total counter
+requests_total{route="\"q\"\\n\n",code="200"} 1
+requests_total{route="/a",code="500"} 1
+requests_total{route="/b",code="200"} 2
+# HELP in_flight In flight.
+# TYPE in_flight gauge
+in_flight{route="/a"} 1
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.1"} 2
+duration_seconds_bucket{route="/a",le="0.5"} 2
+duration_seconds_bucket{route="/a",le="1"} 3
+duration_seconds_bucket{route="/a",le="+Inf"} 4
+duration_seconds_sum{route="/a"} 3.85
+duration_seconds_count{route="/a"} 4
+# HELP pool_size Pool size.
+# TYPE pool_size gauge
+pool_size 1
+# HELP big_total Big.
+# TYPE big_total counter
+big_total +Inf
+`
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("got %d bytes written; want %d", n, buf.Len())
+	}
+
+	// The OnCollect functions run on every write, before the metrics are read.
+	buf.Reset()
+	r.WriteTo(&buf)
+	if !bytes.Contains(buf.Bytes(), []byte("\npool_size 2\n")) {
+		t.Errorf("OnCollect function not called again:\n%s", buf.String())
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1})
+	h.Observe(2)
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="1"} 0
+latency_seconds_bucket{le="+Inf"} 1
+latency_seconds_sum 2
+latency_seconds_count 1
+`
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWrongNumberOfLabelValues(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Requests.", "route", "code").Inc("/a")
+}
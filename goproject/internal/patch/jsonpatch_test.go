@@ -0,0 +1,106 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`},
+		{"add array index", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"add array end index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/2","value":3}]`, `{"a":[1,2,3]}`},
+		{"add array dash", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`},
+		{"add root", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove array index", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"remove root array index", `[1,2,3]`, `[{"op":"remove","path":"/0"}]`, `[2,3]`},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`},
+		{"replace array index", `{"a":[1,2,3]}`, `[{"op":"replace","path":"/a/1","value":9}]`, `{"a":[1,9,3]}`},
+		{"replace root array index", `[1,2,3]`, `[{"op":"replace","path":"/1","value":9}]`, `[1,9,3]`},
+		{"replace last root array index", `[1,2,3]`, `[{"op":"replace","path":"/2","value":9}]`, `[1,2,9]`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`},
+		{"move member", `{"a":1,"b":{}}`, `[{"op":"move","from":"/a","path":"/b/c"}]`, `{"b":{"c":1}}`},
+		{"move array element", `[1,2,3]`, `[{"op":"move","from":"/0","path":"/-"}]`, `[2,3,1]`},
+		{"copy member", `{"a":{"x":1}}`, `[{"op":"copy","from":"/a","path":"/b"},{"op":"replace","path":"/b/x","value":2}]`, `{"a":{"x":1},"b":{"x":2}}`},
+		{"test passes", `{"a":[1,"x"]}`, `[{"op":"test","path":"/a","value":[1,"x"]}]`, `{"a":[1,"x"]}`},
+		{"test number against decimal", `{"a":1.0}`, `[{"op":"test","path":"/a","value":1}]`, `{"a":1.0}`},
+		{"test number against exponent", `{"a":1e0}`, `[{"op":"test","path":"/a","value":1.00}]`, `{"a":1e0}`},
+		{"test nested numbers", `{"a":{"b":[10,0.5]}}`, `[{"op":"test","path":"/a","value":{"b":[1e1,5e-1]}}]`, `{"a":{"b":[10,0.5]}}`},
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escaped tilde", `{"m~n":1}`, `[{"op":"remove","path":"/m~0n"}]`, `{}`},
+		{"escape order", `{"~1":1}`, `[{"op":"add","path":"/~01","value":2}]`, `{"~1":2}`},
+		{"operations in order", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"remove","path":"/a"}]`, `{"b":2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{"not an array", `{}`, `{"op":"add","path":"/a","value":1}`},
+		{"unknown op", `{}`, `[{"op":"merge","path":"/a","value":1}]`},
+		{"missing path", `{}`, `[{"op":"add","value":1}]`},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`},
+		{"missing from", `{"a":1}`, `[{"op":"move","path":"/b"}]`},
+		{"path without slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`},
+		{"add past array end", `[1]`, `[{"op":"add","path":"/2","value":1}]`},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`},
+		{"remove dash", `[1]`, `[{"op":"remove","path":"/-"}]`},
+		{"leading zero index", `[1,2]`, `[{"op":"remove","path":"/01"}]`},
+		{"negative index", `[1,2]`, `[{"op":"remove","path":"/-1"}]`},
+		{"index out of range", `[1,2]`, `[{"op":"replace","path":"/2","value":3}]`},
+		{"move into child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`},
+		{"test different value", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`},
+		{"test different number", `{"a":1.0}`, `[{"op":"test","path":"/a","value":1.000001}]`},
+		{"test extra member", `{"a":{"b":1}}`, `[{"op":"test","path":"/a","value":{"b":1,"c":1}}]`},
+		{"test different type", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`},
+		{"test missing member", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`},
+		{"failed test discards earlier ops", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if !errors.Is(err, ErrInvalidPatch) {
+				t.Fatalf("got %s, %v; want ErrInvalidPatch", got, err)
+			}
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
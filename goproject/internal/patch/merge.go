@@ -0,0 +1,55 @@
+// Package patch applies partial-update documents to JSON resources. It supports JSON
+// Merge Patch (RFC 7396) and JSON Patch (RFC 6902).
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Media types for the two patch formats, as sent in the Content-Type header.
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var ErrInvalidPatch = errors.New("invalid patch document")
+
+// MergePatch applies a JSON Merge Patch (RFC 7396) to the JSON document doc and returns
+// the patched document. Members of the patch that are null remove the matching member
+// from the document, objects are merged recursively and any other value replaces the
+// original one.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
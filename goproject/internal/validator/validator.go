@@ -2,6 +2,7 @@ package validator
 
 import (
 	"regexp"
+	"unicode"
 )
 
 // Declare a regular expression for sanity checking the format of email addresses (we'll
@@ -65,4 +66,29 @@ func Unique(values []string) bool {
 	}
 	
 	return len(values) == len(uniqueValues)
-}
\ No newline at end of file
+}
+
+// IsEmail returns true if a string value is a plausible email address. Addresses longer
+// than 254 bytes can't be delivered, so they are rejected as well.
+func IsEmail(value string) bool {
+	return len(value) <= 254 && Matches(value, EmailRX)
+}
+
+// StrongPassword returns true if a password mixes at least three of the four classes of
+// characters: lowercase letters, uppercase letters, digits and anything else.
+func StrongPassword(value string) bool {
+	var lower, upper, digit, other int
+	for _, r := range value {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower+upper+digit+other >= 3
+}
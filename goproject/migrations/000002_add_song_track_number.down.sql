@@ -0,0 +1,5 @@
+ALTER TABLE song DROP CONSTRAINT IF EXISTS song_album_track_number_key;
+
+ALTER TABLE song DROP CONSTRAINT IF EXISTS song_track_number_check;
+
+ALTER TABLE song DROP COLUMN IF EXISTS track_number;
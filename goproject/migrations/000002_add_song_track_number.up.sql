@@ -0,0 +1,5 @@
+ALTER TABLE song ADD COLUMN track_number INTEGER;
+
+ALTER TABLE song ADD CONSTRAINT song_track_number_check CHECK (track_number > 0);
+
+ALTER TABLE song ADD CONSTRAINT song_album_track_number_key UNIQUE (album_id, track_number);
@@ -0,0 +1 @@
+ALTER TABLE album DROP COLUMN IF EXISTS release_date;
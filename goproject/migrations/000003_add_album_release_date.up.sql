@@ -0,0 +1 @@
+ALTER TABLE album ADD COLUMN release_date DATE;
@@ -0,0 +1,7 @@
+ALTER TABLE song ALTER COLUMN song_id DROP IDENTITY IF EXISTS;
+
+ALTER TABLE album ALTER COLUMN album_id DROP IDENTITY IF EXISTS;
+
+ALTER TABLE singer ALTER COLUMN singer_id DROP IDENTITY IF EXISTS;
+
+ALTER TABLE groups ALTER COLUMN group_id DROP IDENTITY IF EXISTS;
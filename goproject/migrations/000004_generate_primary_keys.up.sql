@@ -0,0 +1,11 @@
+ALTER TABLE groups ALTER COLUMN group_id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('groups', 'group_id'), COALESCE(MAX(group_id), 0) + 1, false) FROM groups;
+
+ALTER TABLE singer ALTER COLUMN singer_id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('singer', 'singer_id'), COALESCE(MAX(singer_id), 0) + 1, false) FROM singer;
+
+ALTER TABLE album ALTER COLUMN album_id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('album', 'album_id'), COALESCE(MAX(album_id), 0) + 1, false) FROM album;
+
+ALTER TABLE song ALTER COLUMN song_id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('song', 'song_id'), COALESCE(MAX(song_id), 0) + 1, false) FROM song;
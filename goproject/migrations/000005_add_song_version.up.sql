@@ -0,0 +1 @@
+ALTER TABLE song ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
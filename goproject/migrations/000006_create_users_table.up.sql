@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE users (
+    user_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    name VARCHAR(500) NOT NULL,
+    email CITEXT UNIQUE NOT NULL,
+    password_hash BYTEA NOT NULL,
+    activated BOOLEAN NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1
+);
@@ -0,0 +1,21 @@
+CREATE TABLE permission (
+    permission_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    code TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE user_permission (
+    user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permission(permission_id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permission (code)
+VALUES
+    ('songs:read'),
+    ('songs:write'),
+    ('groups:read'),
+    ('groups:write'),
+    ('singers:read'),
+    ('singers:write'),
+    ('albums:read'),
+    ('albums:write');
@@ -0,0 +1,2 @@
+DELETE FROM permission WHERE code = 'apikeys:admin';
+DROP TABLE IF EXISTS api_key;
@@ -3,7 +3,8 @@ package model
 import (
 	"database/sql"
 	"errors"
-	"log"
+
+	"github.com/ulpashk/Golang_2024/pkg/jsonlog"
 )
 
 type Group struct {
@@ -14,9 +15,8 @@ type Group struct {
 }
 
 type GroupModel struct {
-	DB       *sql.DB
-	InfoLog  *log.Logger
-	ErrorLog *log.Logger
+	DB     *sql.DB
+	Logger *jsonlog.Logger
 }
 
 type Restaurant struct {
@@ -31,9 +31,8 @@ type Restaurant struct {
 }
 
 type RestaurantModel struct {
-	DB       *sql.DB
-	InfoLog  *log.Logger
-	ErrorLog *log.Logger
+	DB     *sql.DB
+	Logger *jsonlog.Logger
 }
 
 var restaurants = []Restaurant{
@@ -2,8 +2,8 @@ package model
 
 import (
 	"database/sql"
-	"log"
-	"os"
+
+	"github.com/ulpashk/Golang_2024/pkg/jsonlog"
 )
 
 
@@ -12,19 +12,15 @@ type Models struct {
 	Groups 		GroupModel
 }
 
-func NewModels(db *sql.DB) Models {
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+func NewModels(db *sql.DB, logger *jsonlog.Logger) Models {
 	return Models{
 		Songs: SongModel{
-			DB:       db,
-			InfoLog:  infoLog,
-			ErrorLog: errorLog,
+			DB:     db,
+			Logger: logger,
 		},
 		Groups: GroupModel{
-			DB:       db,
-			InfoLog:  infoLog,
-			ErrorLog: errorLog,
+			DB:     db,
+			Logger: logger,
 		},
 	}
 }
\ No newline at end of file
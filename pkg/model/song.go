@@ -3,22 +3,22 @@ package model
 import (
 	"context"
 	"database/sql"
-	"log"
 	"time"
+
+	"github.com/ulpashk/Golang_2024/pkg/jsonlog"
 )
 
 type Song struct{
 	Id 			string	`json:"id"`
 	Title 		string	`json:"title"`
-	Length 		int		`json:"length"`
+	Length 		*int	`json:"length"`
 	Album_id	int 	`json:"albumId"`
 } 
 
 
 type SongModel struct {
-	DB       *sql.DB
-	InfoLog  *log.Logger
-	ErrorLog *log.Logger
+	DB     *sql.DB
+	Logger *jsonlog.Logger
 }
 
 